@@ -0,0 +1,360 @@
+package gzip
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "hash/crc32"
+    "io"
+    "sort"
+
+    "github.com/goossaert/compression/gzip/deflate"
+)
+
+const (
+    BGZFMaxBlockSize = 65536
+    bgzfMaxDataSize = 0xff00
+    bgzfHeaderSize = 18
+    bgzfFooterSize = 8
+)
+
+var (
+    ErrNotBGZF = errors.New("gzip member is not a BGZF block")
+    ErrInvalidVirtualOffset = errors.New("BGZF virtual offset is beyond its block")
+    ErrBGZFClosed = errors.New("BGZF writer is closed")
+    ErrNotSeeker = errors.New("BGZF reader cannot seek, its reader is not an io.Seeker")
+)
+
+// bgzfEOF is the empty member ending BGZF files.
+var bgzfEOF = []byte{
+    0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43,
+    0x02, 0x00, 0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// VirtualOffset is the offset of a BGZF block in the file, shifted left 16
+// bits, with an offset in the data of the block.
+type VirtualOffset uint64
+
+func MakeVirtualOffset(blockOffset int64, inBlockOffset int) VirtualOffset {
+    return VirtualOffset(blockOffset << 16 | int64(inBlockOffset & 0xffff))
+}
+
+func (v VirtualOffset) BlockOffset() int64 {
+    return int64(v >> 16)
+}
+
+func (v VirtualOffset) InBlockOffset() int {
+    return int(v & 0xffff)
+}
+
+
+// BGZFIndexEntry is where a block starts in the file and in the data.
+type BGZFIndexEntry struct {
+    CompressedOffset uint64
+    UncompressedOffset uint64
+}
+
+// BGZFIndex is the content of a .gzi file: the entries of all the blocks but
+// the first, by increasing offsets.
+type BGZFIndex []BGZFIndexEntry
+
+// WriteTo writes the index as a .gzi file: the number of entries, then the
+// offsets of each, all as 64-bit little-endian numbers.
+func (idx BGZFIndex) WriteTo(w io.Writer) (int64, error) {
+    buf := make([]byte, 8 + 16 * len(idx))
+    binary.LittleEndian.PutUint64(buf, uint64(len(idx)))
+    for i, entry := range idx {
+        binary.LittleEndian.PutUint64(buf[8 + 16 * i:], entry.CompressedOffset)
+        binary.LittleEndian.PutUint64(buf[16 + 16 * i:], entry.UncompressedOffset)
+    }
+    n, err := w.Write(buf)
+    return int64(n), err
+}
+
+// ReadBGZFIndex reads a .gzi file.
+func ReadBGZFIndex(r io.Reader) (BGZFIndex, error) {
+    var count uint64
+    if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+        return nil, err
+    }
+    var idx BGZFIndex
+    for i := uint64(0) ; i < count ; i++ {
+        var entry BGZFIndexEntry
+        if err := binary.Read(r, binary.LittleEndian, &entry); err != nil {
+            if err == io.EOF {
+                err = io.ErrUnexpectedEOF
+            }
+            return nil, err
+        }
+        idx = append(idx, entry)
+    }
+    return idx, nil
+}
+
+// Locate returns the virtual offset of the byte at 'offset' in the data.
+func (idx BGZFIndex) Locate(offset int64) VirtualOffset {
+    i := sort.Search(len(idx), func(i int) bool {
+        return idx[i].UncompressedOffset > uint64(offset)
+    })
+    if i == 0 {
+        return MakeVirtualOffset(0, int(offset))
+    }
+    entry := idx[i - 1]
+    return MakeVirtualOffset(int64(entry.CompressedOffset), int(uint64(offset) - entry.UncompressedOffset))
+}
+
+
+// bgzfBlockSize returns the size of the BGZF block whose header starts
+// 'header', from its 'BC' subfield.
+func bgzfBlockSize(header []byte) (int, error) {
+    rb := deflate.NewReadBuffer(bytes.NewReader(header), len(header))
+    h, err := readHeader(rb)
+    if err != nil {
+        return 0, err
+    }
+    bsize := h.Subfield('B', 'C')
+    if len(bsize) != 2 {
+        return 0, ErrNotBGZF
+    }
+    return int(binary.LittleEndian.Uint16(bsize)) + 1, nil
+}
+
+
+// BGZFWriter writes data as BGZF blocks, and records their index. BGZF, the
+// blocked gzip of SAMtools, is made of members of 64 KiB at most, each with
+// a 'BC' subfield holding its size minus one, and ends with an empty member.
+type BGZFWriter struct {
+    writer io.Writer
+    level int
+    dw *deflate.Writer
+    stored *deflate.Writer // for the blocks that do not fit compressed
+    block []byte
+    compressed bytes.Buffer
+    offset int64 // size of the blocks written
+    dataOffset int64 // size of their data
+    index BGZFIndex
+    err error
+}
+
+func NewBGZFWriter(w io.Writer, level int) (*BGZFWriter, error) {
+    dw, err := deflate.NewWriter(nil, level)
+    if err != nil {
+        return nil, err
+    }
+    bw := new(BGZFWriter)
+    bw.writer = w
+    bw.level = level
+    bw.dw = dw
+    bw.block = make([]byte, 0, bgzfMaxDataSize)
+    return bw, nil
+}
+
+func (bw *BGZFWriter) Write(p []byte) (int, error) {
+    if bw.err != nil {
+        return 0, bw.err
+    }
+    n := len(p)
+    for len(p) > 0 {
+        size := bgzfMaxDataSize - len(bw.block)
+        if size > len(p) {
+            size = len(p)
+        }
+        bw.block = append(bw.block, p[:size]...)
+        p = p[size:]
+        if len(bw.block) == bgzfMaxDataSize {
+            if err := bw.Flush(); err != nil {
+                return 0, err
+            }
+        }
+    }
+    return n, nil
+}
+
+// VirtualOffset returns the virtual offset of the next byte written.
+func (bw *BGZFWriter) VirtualOffset() VirtualOffset {
+    return MakeVirtualOffset(bw.offset, len(bw.block))
+}
+
+// Index returns the index of the blocks written so far.
+func (bw *BGZFWriter) Index() BGZFIndex {
+    return bw.index
+}
+
+// Flush writes the data written so far as a block, so that the next data
+// starts a new block.
+func (bw *BGZFWriter) Flush() error {
+    if bw.err != nil {
+        return bw.err
+    }
+    if len(bw.block) == 0 {
+        return nil
+    }
+    if bw.offset > 0 {
+        bw.index = append(bw.index, BGZFIndexEntry{uint64(bw.offset), uint64(bw.dataOffset)})
+    }
+
+    bw.compressed.Reset()
+    bw.dw.Reset(&bw.compressed)
+    bw.dw.Write(bw.block)
+    if bw.err = bw.dw.Close(); bw.err != nil {
+        return bw.err
+    }
+    if bgzfHeaderSize + bw.compressed.Len() + bgzfFooterSize > BGZFMaxBlockSize {
+        if bw.stored == nil {
+            bw.stored, _ = deflate.NewWriter(nil, deflate.NoCompression)
+        }
+        bw.compressed.Reset()
+        bw.stored.Reset(&bw.compressed)
+        bw.stored.Write(bw.block)
+        if bw.err = bw.stored.Close(); bw.err != nil {
+            return bw.err
+        }
+    }
+
+    size := bgzfHeaderSize + bw.compressed.Len() + bgzfFooterSize
+    header := make([]byte, bgzfHeaderSize)
+    copy(header, bgzfEOF[:bgzfHeaderSize])
+    header[8] = extraFlags(bw.level)
+    binary.LittleEndian.PutUint16(header[16:], uint16(size - 1))
+    for _, b := range [][]byte{header, bw.compressed.Bytes(), footerBytes(crc32.ChecksumIEEE(bw.block), int64(len(bw.block)))} {
+        if _, bw.err = bw.writer.Write(b); bw.err != nil {
+            return bw.err
+        }
+    }
+    bw.offset += int64(size)
+    bw.dataOffset += int64(len(bw.block))
+    bw.block = bw.block[:0]
+    return nil
+}
+
+// Close writes the last block and the empty block ending the file. It does
+// not close the underlying writer.
+func (bw *BGZFWriter) Close() error {
+    if bw.err == ErrBGZFClosed {
+        return nil
+    }
+    if err := bw.Flush(); err != nil {
+        return err
+    }
+    if _, bw.err = bw.writer.Write(bgzfEOF); bw.err != nil {
+        return bw.err
+    }
+    bw.offset += int64(len(bgzfEOF))
+    bw.err = ErrBGZFClosed
+    return nil
+}
+
+
+// BGZFReader reads the data of BGZF blocks, and can seek to virtual offsets
+// when its reader is an io.Seeker.
+type BGZFReader struct {
+    reader io.Reader
+    rb *deflate.ReadBuffer
+    compressed []byte
+    data bytes.Buffer
+    pos int // bytes of 'data' read
+    blockOffset int64 // offset of the block of 'data'
+    nextOffset int64 // offset of the block after it
+    err error
+}
+
+func NewBGZFReader(r io.Reader) *BGZFReader {
+    br := new(BGZFReader)
+    br.reader = r
+    br.rb = deflate.NewReadBuffer(nil, 4096)
+    br.compressed = make([]byte, BGZFMaxBlockSize)
+    return br
+}
+
+func (br *BGZFReader) Read(p []byte) (int, error) {
+    for br.pos == br.data.Len() {
+        if br.err != nil {
+            return 0, br.err
+        }
+        br.err = br.readBlock()
+    }
+    n := copy(p, br.data.Bytes()[br.pos:])
+    br.pos += n
+    return n, nil
+}
+
+// VirtualOffset returns the virtual offset of the next byte read.
+func (br *BGZFReader) VirtualOffset() VirtualOffset {
+    if br.pos == br.data.Len() {
+        return MakeVirtualOffset(br.nextOffset, 0)
+    }
+    return MakeVirtualOffset(br.blockOffset, br.pos)
+}
+
+// Seek makes the next byte read the one at the virtual offset 'v'. The
+// reader must be an io.Seeker.
+func (br *BGZFReader) Seek(v VirtualOffset) error {
+    seeker, ok := br.reader.(io.Seeker)
+    if !ok {
+        return ErrNotSeeker
+    }
+    if _, err := seeker.Seek(v.BlockOffset(), io.SeekStart); err != nil {
+        return err
+    }
+    br.nextOffset = v.BlockOffset()
+    br.data.Reset()
+    br.pos = 0
+    if br.err = br.readBlock(); br.err != nil && br.err != io.EOF {
+        return br.err
+    }
+    if v.InBlockOffset() > br.data.Len() {
+        return ErrInvalidVirtualOffset
+    }
+    br.pos = v.InBlockOffset()
+    return nil
+}
+
+// readBlock reads and decodes the block at 'nextOffset'. It returns io.EOF
+// if the reader has no more blocks.
+func (br *BGZFReader) readBlock() error {
+    header := br.compressed[:bgzfHeaderSize]
+    if _, err := io.ReadFull(br.reader, header); err != nil {
+        return err
+    }
+    if header[3] & ExtraFieldPresent == 0 {
+        return ErrNotBGZF
+    }
+    // Other subfields may come before 'BC'
+    headerSize := 12 + int(binary.LittleEndian.Uint16(header[10:12]))
+    if headerSize + bgzfFooterSize > BGZFMaxBlockSize {
+        return ErrNotBGZF
+    }
+    if headerSize > bgzfHeaderSize {
+        if _, err := io.ReadFull(br.reader, br.compressed[bgzfHeaderSize:headerSize]); err != nil {
+            return noEOF(err)
+        }
+    }
+    size, err := bgzfBlockSize(br.compressed[:headerSize])
+    if err != nil {
+        return noEOF(err)
+    }
+    if size < headerSize + bgzfFooterSize {
+        return ErrNotBGZF
+    }
+    if _, err := io.ReadFull(br.reader, br.compressed[headerSize:size]); err != nil {
+        return noEOF(err)
+    }
+
+    br.data.Reset()
+    br.pos = 0
+    br.rb.Reset(bytes.NewReader(br.compressed[:size]))
+    if _, err := decompressMember(br.rb, &br.data); err != nil {
+        return err
+    }
+    br.blockOffset = br.nextOffset
+    br.nextOffset += int64(size)
+    return nil
+}
+
+// noEOF returns io.ErrUnexpectedEOF for io.EOF, as a block is cut.
+func noEOF(err error) error {
+    if err == io.EOF {
+        return io.ErrUnexpectedEOF
+    }
+    return err
+}
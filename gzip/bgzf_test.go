@@ -0,0 +1,123 @@
+package gzip
+
+import (
+    "bytes"
+    stdgzip "compress/gzip"
+    "io"
+    "io/ioutil"
+    "math/rand"
+    "testing"
+)
+
+func TestBGZF(t *testing.T) {
+    data := parallelData(300000)
+    random := make([]byte, 100000)
+    rand.New(rand.NewSource(1)).Read(random)
+    data = append(data, random...)
+
+    // Writes records, keeping the virtual offset of each
+    var buf bytes.Buffer
+    w, err := NewBGZFWriter(&buf, 6)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var offsets []VirtualOffset
+    var starts []int
+    for i := 0 ; i < len(data) ; i += 9973 {
+        end := i + 9973
+        if end > len(data) {
+            end = len(data)
+        }
+        offsets = append(offsets, w.VirtualOffset())
+        starts = append(starts, i)
+        w.Write(data[i:end])
+    }
+    if err := w.Close() ; err != nil {
+        t.Fatal(err)
+    }
+    compressed := buf.Bytes()
+    if !bytes.HasSuffix(compressed, bgzfEOF) {
+        t.Errorf("The file does not end with the BGZF EOF block")
+    }
+
+    // Every member is a BGZF block of 64 KiB at most
+    for offset := 0 ; offset < len(compressed) ; {
+        size, err := bgzfBlockSize(compressed[offset:])
+        if err != nil {
+            t.Fatalf("Block at %d: %v", offset, err)
+        }
+        if size > BGZFMaxBlockSize {
+            t.Errorf("Block at %d is %d bytes", offset, size)
+        }
+        offset += size
+    }
+
+    // Readers of multi-member gzip read it all
+    r, _ := stdgzip.NewReader(bytes.NewReader(compressed))
+    if out, err := ioutil.ReadAll(r) ; err != nil || !bytes.Equal(out, data) {
+        t.Errorf("The data does not round trip through compress/gzip: %v", err)
+    }
+    if out, err := ioutil.ReadAll(NewParallelReader(bytes.NewReader(compressed), 4)) ; err != nil || !bytes.Equal(out, data) {
+        t.Errorf("The data does not round trip through ParallelReader: %v", err)
+    }
+    br := NewBGZFReader(bytes.NewReader(compressed))
+    if out, err := ioutil.ReadAll(br) ; err != nil || !bytes.Equal(out, data) {
+        t.Errorf("The data does not round trip through BGZFReader: %v", err)
+    }
+
+    // Seeks to the records, backwards
+    record := make([]byte, 100)
+    for i := len(offsets) - 1 ; i >= 0 ; i-- {
+        if err := br.Seek(offsets[i]) ; err != nil {
+            t.Fatal(err)
+        }
+        if br.VirtualOffset() != offsets[i] && br.VirtualOffset().InBlockOffset() != 0 {
+            t.Errorf("Record %d: virtual offset %x after seeking to %x", i, br.VirtualOffset(), offsets[i])
+        }
+        n, err := io.ReadFull(br, record)
+        if err != nil && err != io.ErrUnexpectedEOF {
+            t.Fatal(err)
+        }
+        if !bytes.Equal(record[:n], data[starts[i]:starts[i] + n]) {
+            t.Errorf("Record %d: wrong data after seeking", i)
+        }
+    }
+
+    // The index finds the same virtual offsets
+    var gzi bytes.Buffer
+    w.Index().WriteTo(&gzi)
+    index, err := ReadBGZFIndex(&gzi)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(index) != len(w.Index()) {
+        t.Fatalf("Expected %d index entries, found %d", len(w.Index()), len(index))
+    }
+    for i, offset := range offsets {
+        if found := index.Locate(int64(starts[i])) ; found != offset {
+            t.Errorf("Record %d: expected virtual offset %x, found %x", i, offset, found)
+        }
+    }
+    position := int64(123456)
+    br.Seek(index.Locate(position))
+    br.Read(record)
+    if !bytes.Equal(record, data[position:position + 100]) {
+        t.Errorf("Wrong data at the virtual offset of the index")
+    }
+}
+
+func TestBGZFReaderInvalid(t *testing.T) {
+    var buf bytes.Buffer
+    WriteGzip(&buf, parallelData(1000), 6)
+    if _, err := ioutil.ReadAll(NewBGZFReader(&buf)) ; err != ErrNotBGZF {
+        t.Errorf("Expected ErrNotBGZF, found %v", err)
+    }
+
+    buf.Reset()
+    w, _ := NewBGZFWriter(&buf, 6)
+    w.Write(parallelData(1000))
+    w.Close()
+    if _, err := ioutil.ReadAll(NewBGZFReader(bytes.NewReader(buf.Bytes()[:100]))) ; err != io.ErrUnexpectedEOF {
+        t.Errorf("Expected io.ErrUnexpectedEOF, found %v", err)
+    }
+}
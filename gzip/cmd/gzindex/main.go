@@ -0,0 +1,68 @@
+// gzindex builds the seek index of a gzip file, and reads its data at any
+// offset with the index.
+//
+//     gzindex [-span bytes] file.gz                  writes file.gz.gzsi
+//     gzindex -offset n -length m file.gz            prints m bytes of data from n
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "log"
+    "os"
+
+    "github.com/goossaert/compression/gzip"
+)
+
+func main() {
+    span := flag.Int64("span", gzip.DefaultSeekSpan, "bytes of data between checkpoints")
+    offset := flag.Int64("offset", -1, "offset of the data to print")
+    length := flag.Int64("length", 4096, "bytes of data to print")
+    flag.Parse()
+    if flag.NArg() != 1 {
+        flag.Usage()
+        os.Exit(2)
+    }
+    filepath := flag.Arg(0)
+    indexpath := filepath + ".gzsi"
+
+    file, err := os.Open(filepath)
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer file.Close()
+
+    if *offset < 0 {
+        index, err := gzip.BuildSeekIndex(file, *span)
+        if err != nil {
+            log.Fatal(err)
+        }
+        out, err := os.Create(indexpath)
+        if err != nil {
+            log.Fatal(err)
+        }
+        defer out.Close()
+        if _, err := index.WriteTo(out); err != nil {
+            log.Fatal(err)
+        }
+        fmt.Printf("%d checkpoints for %d bytes of data\n", len(index.Checkpoints), index.Size)
+        return
+    }
+
+    in, err := os.Open(indexpath)
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer in.Close()
+    index, err := gzip.ReadSeekIndex(in)
+    if err != nil {
+        log.Fatal(err)
+    }
+    ir := gzip.NewIndexedReader(file, index)
+    defer ir.Close()
+    r := io.NewSectionReader(ir, *offset, *length)
+    if _, err := io.Copy(os.Stdout, r); err != nil {
+        log.Fatal(err)
+    }
+}
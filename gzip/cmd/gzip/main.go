@@ -0,0 +1,35 @@
+package main
+
+import (
+    "log"
+    "os"
+    stdgzip "compress/gzip"
+
+    "github.com/goossaert/compression/gzip"
+)
+
+func main() {
+    data := "aaaaabcdefghijbbbbbbbbbbbbbbbbbbbbbaaaaabbb"
+    filepath := "./myfile-custom.gz"
+    file, err := os.OpenFile(filepath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+    if err != nil {
+       log.Fatal(err)
+    }
+    defer file.Close()
+
+    err = gzip.WriteGzipNoCompression(file, []byte(data))
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    f, _ := os.Create("./myfile-stdlib.gz")
+    defer f.Close()
+    w, _ := stdgzip.NewWriterLevel(f, stdgzip.NoCompression)
+    //w := stdgzip.NewWriter(f)
+    w.Write([]byte(data))
+    w.Close()
+
+    if err := gzip.GzipReader("./myfile-stdlib.gz"); err != nil {
+        log.Fatal(err)
+    }
+}
@@ -0,0 +1,65 @@
+package gzip
+
+const crc32Polynomial = 0xedb88320 // IEEE, reversed
+
+// gf2MatrixTimes returns the product of the 32x32 bit matrix 'mat' and the
+// vector 'vec'.
+func gf2MatrixTimes(mat *[32]uint32, vec uint32) uint32 {
+    sum := uint32(0)
+    for i := 0 ; vec != 0 ; i, vec = i + 1, vec >> 1 {
+        if vec & 1 != 0 {
+            sum ^= mat[i]
+        }
+    }
+    return sum
+}
+
+// gf2MatrixSquare sets 'square' to 'mat' times 'mat'.
+func gf2MatrixSquare(square *[32]uint32, mat *[32]uint32) {
+    for i := 0 ; i < 32 ; i++ {
+        square[i] = gf2MatrixTimes(mat, mat[i])
+    }
+}
+
+// crc32Combine returns the CRC-32 of A followed by B, from 'crc1' the CRC-32
+// of A, 'crc2' the CRC-32 of B, and 'len2' the length of B, as zlib's
+// crc32_combine does: appending zero bytes to A is a linear operation over
+// GF(2) on its CRC, whose matrix is squared for each bit of len2.
+func crc32Combine(crc1 uint32, crc2 uint32, len2 int64) uint32 {
+    if len2 <= 0 {
+        return crc1
+    }
+
+    // Operator for one zero bit, then for two and four zero bits
+    var even, odd [32]uint32
+    odd[0] = crc32Polynomial
+    row := uint32(1)
+    for i := 1 ; i < 32 ; i++ {
+        odd[i] = row
+        row <<= 1
+    }
+    gf2MatrixSquare(&even, &odd)
+    gf2MatrixSquare(&odd, &even)
+
+    // Applies len2 zero bytes to crc1, squaring the operator for each bit
+    // of len2, starting with the operator for one zero byte
+    for {
+        gf2MatrixSquare(&even, &odd)
+        if len2 & 1 != 0 {
+            crc1 = gf2MatrixTimes(&even, crc1)
+        }
+        len2 >>= 1
+        if len2 == 0 {
+            break
+        }
+        gf2MatrixSquare(&odd, &even)
+        if len2 & 1 != 0 {
+            crc1 = gf2MatrixTimes(&odd, crc1)
+        }
+        len2 >>= 1
+        if len2 == 0 {
+            break
+        }
+    }
+    return crc1 ^ crc2
+}
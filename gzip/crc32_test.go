@@ -0,0 +1,18 @@
+package gzip
+
+import (
+    "hash/crc32"
+    "testing"
+)
+
+func TestCrc32Combine(t *testing.T) {
+    data := []byte("The CRC-32 of the whole is combined from the CRC-32 of its parts.")
+    for _, split := range []int{0, 1, 7, 32, len(data) - 1, len(data)} {
+        crc1 := crc32.ChecksumIEEE(data[:split])
+        crc2 := crc32.ChecksumIEEE(data[split:])
+        expected := crc32.ChecksumIEEE(data)
+        if found := crc32Combine(crc1, crc2, int64(len(data) - split)) ; found != expected {
+            t.Errorf("Split at %d: expected 0x%08x, found 0x%08x", split, expected, found)
+        }
+    }
+}
@@ -0,0 +1,75 @@
+package deflate
+
+import (
+    "io"
+)
+
+// bitWriter packs bits starting from the least-significant bit of each
+// byte, as RFC 1951 does for every data element. Huffman codes are packed
+// starting from their most-significant bit, so they are reversed first. The
+// first error is kept, and makes all the next writes no-ops.
+type bitWriter struct {
+    writer io.Writer
+    bits uint64
+    nbits uint
+    buf []byte
+    err error
+}
+
+func newBitWriter(writer io.Writer) *bitWriter {
+    bw := new(bitWriter)
+    bw.writer = writer
+    bw.buf = make([]byte, 0, 8192)
+    return bw
+}
+
+func (bw *bitWriter) reset(writer io.Writer) {
+    bw.writer = writer
+    bw.bits = 0
+    bw.nbits = 0
+    bw.buf = bw.buf[:0]
+    bw.err = nil
+}
+
+func (bw *bitWriter) writeBits(value uint64, nbits uint) {
+    bw.bits |= value << bw.nbits
+    bw.nbits += nbits
+    for bw.nbits >= 8 {
+        bw.buf = append(bw.buf, byte(bw.bits))
+        bw.bits >>= 8
+        bw.nbits -= 8
+    }
+    if len(bw.buf) >= cap(bw.buf) - 8 {
+        bw.writeBuffer()
+    }
+}
+
+// alignToByte pads the current byte with zeros.
+func (bw *bitWriter) alignToByte() {
+    if bw.nbits > 0 {
+        bw.writeBits(0, 8 - bw.nbits)
+    }
+}
+
+// writeBytes writes bytes as they are, once aligned to a byte.
+func (bw *bitWriter) writeBytes(p []byte) {
+    bw.writeBuffer()
+    if bw.err != nil {
+        return
+    }
+    _, bw.err = bw.writer.Write(p)
+}
+
+// flush writes out all the complete bytes. The bits of an incomplete byte
+// stay until alignToByte.
+func (bw *bitWriter) flush() error {
+    bw.writeBuffer()
+    return bw.err
+}
+
+func (bw *bitWriter) writeBuffer() {
+    if bw.err == nil && len(bw.buf) > 0 {
+        _, bw.err = bw.writer.Write(bw.buf)
+    }
+    bw.buf = bw.buf[:0]
+}
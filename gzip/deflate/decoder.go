@@ -1,12 +1,12 @@
 package deflate
 
 import (
+    "bytes"
     "io"
     "math/bits"
-    "fmt"
-    "strconv"
-    "encoding/binary"
     "errors"
+
+    "github.com/goossaert/compression/logging"
 )
 
 type translationItem struct {
@@ -43,7 +43,7 @@ var latLenTable = []translationItem{
                     {273, 3,  35,  42},
                     {274, 3,  43,  50},
                     {275, 3,  51,  58},
-                    {276, 3,  59,  68},
+                    {276, 3,  59,  66},
                     {277, 4,  67,  82},
                     {278, 4,  83,  98},
                     {279, 4,  99, 114},
@@ -80,14 +80,36 @@ var distanceTable = []translationItem{
                     {21,  9,  1537,  2048},
                     {22, 10,  2049,  3072},
                     {23, 10,  3073,  4096},
-                    {24, 11,  4097,  6184},
-                    {25, 11,  6185,  8192},
+                    {24, 11,  4097,  6144},
+                    {25, 11,  6145,  8192},
                     {26, 12,  8193, 12288},
                     {27, 12, 12289, 16384},
                     {28, 13, 16385, 24576},
                     {29, 13, 24577, 32768},
                 }
 
+// Deflate64, or enhanced deflate, has a window of 64 KiB, 16 extra bits for
+// the length code 285, from 3 to 65538, and the distance codes 30 and 31.
+const Deflate64WindowSize = 65536
+
+var latLen64Table = append(append([]translationItem(nil), latLenTable[:len(latLenTable) - 1]...),
+                    translationItem{285, 16, 3, 65538})
+
+var distance64Table = append(append([]translationItem(nil), distanceTable...),
+                    translationItem{30, 14, 32769, 49152},
+                    translationItem{31, 14, 49153, 65536})
+
+// format is the tables and the window size of a variant of DEFLATE.
+type format struct {
+    latLen []translationItem
+    distance []translationItem
+    windowSize int
+    fixed *Translator
+}
+
+var deflateFormat = &format{latLen: latLenTable, distance: distanceTable, windowSize: WindowSize}
+var deflate64Format = &format{latLen: latLen64Table, distance: distance64Table, windowSize: Deflate64WindowSize}
+
 func generateUint64BitMasks() ([]uint64, []uint64) {
     leftBitMasks := make([]uint64, 65)
     rightBitMasks := make([]uint64, 65)
@@ -186,243 +208,502 @@ func GenerateCanonicalPrefixes(codeLengths []int) ([]uint64) {
 }
 
 
-type Translator struct {
-    litLenDecodingTables map[int](map[uint64]translationItem)
-    litLenMinBits int
-    litLenMaxBits int
-    distanceDecodingTables map[int](map[uint64]translationItem)
-    distanceMinBits int
-    distanceMaxBits int
-    leftBitMasks []uint64
-    rightBitMasks []uint64
-}
+var (
+    ErrInvalidCodeLengths = errors.New("DEFLATE code lengths do not describe a valid prefix code")
+    ErrInvalidSymbol = errors.New("Invalid DEFLATE symbol")
+    ErrInvalidBlockType = errors.New("Invalid DEFLATE block type")
+    ErrInvalidStoredLength = errors.New("DEFLATE stored block length does not match its complement")
+)
 
-func NewTranslator(litLenSeq []int, distanceSeq []int) *Translator {
-    t := new(Translator)
+const maxCodeBits = 15
 
-    // Generates hash tables to translate prefixes to literals/lengths
-    t.litLenDecodingTables = make(map[int](map[uint64]translationItem))
-    litLenCodes := GenerateCanonicalPrefixes(litLenSeq)
-    t.litLenMinBits, t.litLenMaxBits = GetMinMaxSlice(litLenSeq)
 
-    for i := t.litLenMinBits; i <= t.litLenMaxBits; i++ {
-        t.litLenDecodingTables[i] = make(map[uint64]translationItem)
+// prefixTable decodes a canonical prefix code, looking for the length of
+// the code at the front of a prefix from the shortest length, as puff.c in
+// zlib does.
+type prefixTable struct {
+    counts []int // number of codes of each length
+    symbols []int // symbols by code length, then by symbol value
+}
+
+func newPrefixTable(lengths []int) (*prefixTable, error) {
+    pt := new(prefixTable)
+    if err := pt.set(lengths); err != nil {
+        return nil, err
     }
+    return pt, nil
+}
 
-    for i := 0; i <= 256; i++ {
-        numBits := litLenSeq[i]
-        //if _, ok := t.litLenDecodingTables[numBits]; !ok {
-        //    t.litLenDecodingTables[numBits] = make(map[uint64]translationItem)
-        //}
-        t.litLenDecodingTables[numBits][litLenCodes[i]] = translationItem{i, 0, 0, 0}
+// set builds the table of the codes with the given lengths, reusing its
+// memory. Only the codes of a single symbol can be incomplete.
+func (pt *prefixTable) set(lengths []int) error {
+    if pt.counts == nil {
+        pt.counts = make([]int, maxCodeBits + 1)
+    }
+    for i := range pt.counts {
+        pt.counts[i] = 0
+    }
+    for _, length := range lengths {
+        if length < 0 || length > maxCodeBits {
+            return ErrInvalidCodeLengths
+        }
+        pt.counts[length] += 1
+    }
+    used := len(lengths) - pt.counts[0]
+    pt.counts[0] = 0
+
+    left := 1
+    for length := 1 ; length <= maxCodeBits ; length++ {
+        left = left << 1 - pt.counts[length]
+        if left < 0 {
+            return ErrInvalidCodeLengths
+        }
+    }
+    if left > 0 && used > 1 {
+        return ErrInvalidCodeLengths
     }
 
-    for i := 0; i < len(latLenTable); i++ {
-        numBits := litLenSeq[i+257]
-        //if _, ok := t.litLenDecodingTables[numBits]; !ok {
-        //    t.litLenDecodingTables[numBits] = make(map[uint64]translationItem)
-        //}
-        t.litLenDecodingTables[numBits][litLenCodes[i+257]] = latLenTable[i]
+    pt.symbols = pt.symbols[:0]
+    for length := 1 ; length <= maxCodeBits ; length++ {
+        for symbol, l := range lengths {
+            if l == length {
+                pt.symbols = append(pt.symbols, symbol)
+            }
+        }
     }
+    return nil
+}
 
-    // Generates hash table to translate prefixes to distances
-    // TODO right now it's only a size of 5 bits because I'm testing the fixed encoding mode only,
-    //      but this will have to be adjusted for dynamic mode.
-    t.distanceDecodingTables = make(map[int](map[uint64]translationItem))
-    t.distanceDecodingTables[5] = make(map[uint64]translationItem)
-    distanceCodes := GenerateCanonicalPrefixes(distanceSeq)
-    for i := 0; i < len(distanceTable); i++ {
-        t.distanceDecodingTables[5][distanceCodes[i]] = distanceTable[i]
+// decode returns the symbol of the code at the front of 'prefix', and the
+// length of the code, or -1 if no code matches.
+func (pt *prefixTable) decode(prefix uint64) (symbol int, numBits int) {
+    code, first, index := 0, 0, 0
+    for length := 1 ; length <= maxCodeBits ; length++ {
+        code |= int(prefix >> 63)
+        prefix <<= 1
+        count := pt.counts[length]
+        if code - first < count {
+            return pt.symbols[index + code - first], length
+        }
+        index += count
+        first = (first + count) << 1
+        code <<= 1
     }
-    t.distanceMinBits = 5
-    t.distanceMaxBits = 5
+    return -1, 0
+}
 
-    // Generate bit masks
-    t.leftBitMasks, t.rightBitMasks = generateUint64BitMasks()
 
-    return t
+type Translator struct {
+    litLen prefixTable
+    distance prefixTable
+    format *format
 }
 
+var _, rightBitMasks = generateUint64BitMasks()
 
-func (t *Translator) decodePrefix(prefix uint64) (numBitsRead uint, isLiteral bool, litLen, distance int, err error) {
-    numBitsRead = 0
-    litLen = 0
-    distance = 0
-    litLenFound := false
-    isLiteral = false
-    for numBits := t.litLenMinBits; numBits <= t.litLenMaxBits; numBits++ {
-        maskedPrefix := prefix & t.leftBitMasks[numBits]
-        if item, ok := t.litLenDecodingTables[numBits][maskedPrefix]; ok {
-            fmt.Printf("LitLen %0*s - %d\n", 64, strconv.FormatUint(maskedPrefix, 2), item.code)
-            if item.code <= 256 {
-                litLen = item.code
-                isLiteral = true
-                fmt.Printf("  => Literal '%s'\n", string(litLen))
-            } else {
-                extraBits := int(bits.Reverse64(prefix << uint(numBits)) & t.rightBitMasks[item.numExtraBits])
-                litLen = item.minRange + extraBits
-                fmt.Printf("  => %0*s\n", 64, strconv.FormatUint(uint64(extraBits), 2))
-                fmt.Printf("  => Length %d\n", litLen)
-            }
-            numBitsRead += uint(numBits + item.numExtraBits)
-            litLenFound = true
-            break
-        }
+func NewTranslator(litLenSeq []int, distanceSeq []int) (*Translator, error) {
+    t := new(Translator)
+    t.format = deflateFormat
+    if err := t.set(litLenSeq, distanceSeq); err != nil {
+        return nil, err
     }
+    return t, nil
+}
+
+// set builds the tables of the given codes, reusing their memory.
+func (t *Translator) set(litLenSeq []int, distanceSeq []int) error {
+    if err := t.litLen.set(litLenSeq); err != nil {
+        return err
+    }
+    return t.distance.set(distanceSeq)
+}
 
-    if litLenFound == false {
-        // Invalid input data
+// decodePrefix decodes the literal, end of block or match at the front of
+// 'prefix', which holds at least the maxSymbolBits bits of the longest match.
+func (t *Translator) decodePrefix(prefix uint64) (numBitsRead uint, isLiteral bool, litLen, distance int, err error) {
+    symbol, numBits := t.litLen.decode(prefix)
+    if symbol < 0 || symbol >= 257 + len(t.format.latLen) {
+        return 0, false, 0, 0, ErrInvalidSymbol
+    }
+    if symbol <= 256 {
+        return uint(numBits), true, symbol, 0, nil
+    }
+    item := t.format.latLen[symbol - 257]
+    prefix <<= uint(numBits)
+    litLen = item.minRange + int(bits.Reverse64(prefix) & rightBitMasks[item.numExtraBits])
+    numBitsRead = uint(numBits + item.numExtraBits)
+
+    prefix <<= uint(item.numExtraBits)
+    symbol, numBits = t.distance.decode(prefix)
+    if symbol < 0 || symbol >= len(t.format.distance) {
+        return 0, false, 0, 0, ErrInvalidSymbol
     }
+    item = t.format.distance[symbol]
+    prefix <<= uint(numBits)
+    distance = item.minRange + int(bits.Reverse64(prefix) & rightBitMasks[item.numExtraBits])
+    numBitsRead += uint(numBits + item.numExtraBits)
+    return numBitsRead, false, litLen, distance, nil
+}
+
+// The fixed distance code also has the codes of the unused symbols 30 and
+// 31, so that it is complete.
+var fixedTranslator, _ = NewTranslator(GenerateMode2LitLenSequence(), append(GenerateMode2DistanceSequence(), 5, 5))
+
+func init() {
+    deflateFormat.fixed = fixedTranslator
+    fixed64 := *fixedTranslator
+    fixed64.format = deflate64Format
+    deflate64Format.fixed = &fixed64
+}
+
+
+// Reader decompresses a DEFLATE stream.
+type Reader struct {
+    rb *ReadBuffer
+    wb *WriteBuffer
+    out bytes.Buffer // data decoded but not read yet
+    translator *Translator // codes of the current block, nil for a stored block
+    dynamic Translator // codes of the last dynamic block
+    codeLengths prefixTable
+    lengths []int
+    header dynamicHeader
+    dict []byte
+    headerRead bool // the 3 bits of the block header are read
+    blockType int
+    inBlock bool
+    storedLeft int // bytes of the current stored block not copied yet
+    lastBlock bool
+    format *format
+    err error
+}
+
+func NewReader(reader io.Reader) *Reader {
+    return newReader(NewReadBuffer(reader, 4096), nil, nil, deflateFormat)
+}
+
+// NewDeflate64Reader returns a reader of a Deflate64 stream, as the method 9
+// of ZIP files.
+func NewDeflate64Reader(reader io.Reader) *Reader {
+    return newReader(NewReadBuffer(reader, 4096), nil, nil, deflate64Format)
+}
 
-    if isLiteral {
-        return numBitsRead, isLiteral, litLen, 0, nil
+// NewReaderDict returns a reader of the data compressed with the preset
+// dictionary 'dict', as NewWriterDict writes it.
+func NewReaderDict(reader io.Reader, dict []byte) *Reader {
+    return newReader(NewReadBuffer(reader, 4096), nil, dict, deflateFormat)
+}
+
+// newReader returns a reader whose data goes to 'writer', or else is
+// buffered for Read.
+func newReader(rb *ReadBuffer, writer io.Writer, dict []byte, f *format) *Reader {
+    r := new(Reader)
+    r.rb = rb
+    r.format = f
+    r.dynamic.format = f
+    if writer == nil {
+        writer = &r.out
     }
+    r.wb = NewWriteBuffer(writer, f.windowSize)
+    r.wb.SetDictionary(dict)
+    r.dict = dict
+    r.lengths = make([]int, 0, numLitLenCodes + len(f.distance))
+    return r
+}
 
-    prefix = prefix << numBitsRead
-    distanceFound := false
-    for numBits := t.distanceMinBits; numBits <= t.distanceMaxBits; numBits++ {
-        maskedPrefix := prefix & t.leftBitMasks[numBits]
-        if item, ok := t.distanceDecodingTables[numBits][maskedPrefix]; ok {
-            extraBits := int((bits.Reverse64(prefix) >> uint(numBits)) & t.rightBitMasks[item.numExtraBits])
-            distance = item.minRange + extraBits
-            numBitsRead += uint(numBits + item.numExtraBits)
-            fmt.Printf("Distance %0*s\n", 64, strconv.FormatUint(maskedPrefix, 2))
-            fmt.Printf("  => %0*s\n", 64, strconv.FormatUint(uint64(extraBits), 2))
-            fmt.Printf("  => %d\n", distance)
-            distanceFound = true
-            break
+// Reset makes the reader decode a new stream from 'reader', with the same
+// dictionary, reusing all its memory.
+func (r *Reader) Reset(reader io.Reader) {
+    r.rb.Reset(reader)
+    r.wb.Reset(&r.out)
+    r.wb.SetDictionary(r.dict)
+    r.out.Reset()
+    r.translator = nil
+    r.header = dynamicHeader{}
+    r.lengths = r.lengths[:0]
+    r.headerRead = false
+    r.inBlock = false
+    r.storedLeft = 0
+    r.lastBlock = false
+    r.err = nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+    for r.out.Len() == 0 && r.err == nil {
+        r.err = r.step()
+        if err := r.wb.Flush(); err != nil && r.err == nil {
+            r.err = err
         }
     }
-
-    if distanceFound == false {
-        // Invalid input data
+    if r.out.Len() > 0 {
+        return r.out.Read(p)
     }
+    return 0, r.err
+}
 
-    return numBitsRead, isLiteral, litLen, distance, nil
+// Close does not close the underlying reader.
+func (r *Reader) Close() error {
+    if r.err == io.EOF {
+        return nil
+    }
+    return r.err
 }
 
+// Number of symbols, or of bytes of a stored block, decoded at most by each
+// step
+const stepSize = 4096
 
-func copyBytes(wb *WriteBuffer, rb *ReadBuffer, n int) error {
-    i := 0
-    for i < n {
-        step := 1024
-        if i + step > n {
-            step = n - i
+// step decodes a block header, or part of a block. It returns io.EOF after
+// the last block.
+func (r *Reader) step() error {
+    if !r.inBlock {
+        if r.lastBlock && !r.headerRead {
+            return io.EOF
         }
-        data, numBytesRead, err := rb.ReadAlignedBytes(step)
+        return r.readBlockHeader()
+    }
+    if r.translator == nil {
+        return r.copyStored()
+    }
+    return r.decodeSymbols()
+}
+
+// readBlockHeader reads the header of a block. As all the reads of the
+// Reader, it reads whole elements only, a field or a code with its extra
+// bits, and keeps its progress, so that it can go on from where it stopped
+// once the input has more bytes.
+func (r *Reader) readBlockHeader() error {
+    if !r.headerRead {
+        header, err := r.rb.ReadBits(3)
         if err != nil {
             return err
         }
+        r.lastBlock = header & 1 == 1
+        r.blockType = header >> 1
+        r.headerRead = true
+        logging.Trace.Printf("Last block: %v, compression mode: %d\n", r.lastBlock, r.blockType)
+    }
 
-        wb.WriteBytes(data)
-        i += numBytesRead
+    switch r.blockType {
+    case DeflateNoCompression:
+        // From RFC 1951, 3.2.4. "Any bits of input up to
+        // the next byte boundary are ignored."
+        r.rb.AlignToByte()
+        lengths, err := r.rb.ReadBits(32)
+        if err != nil {
+            return err
+        }
+        length, lengthOneComplement := lengths & 0xffff, lengths >> 16
+        if length != ^lengthOneComplement & 0xffff {
+            return ErrInvalidStoredLength
+        }
+        r.translator = nil
+        r.storedLeft = length
+    case DeflateFixed:
+        r.translator = r.format.fixed
+    case DeflateDynamic:
+        if err := r.readDynamicHeader(); err != nil {
+            return err
+        }
+        r.translator = &r.dynamic
+    default:
+        return ErrInvalidBlockType
     }
+    r.headerRead = false
+    r.inBlock = true
     return nil
 }
 
-
-//func DecodeStream(reader io.Reader, writer io.Writer) error {
-func DecodeStream(rb *ReadBuffer, writer io.Writer) error {
-
-    fmt.Printf("DecodeStream()\n");
-
-    //rb := NewReadBuffer(reader, 4096)
-    wb := NewWriteBuffer(writer, 32768)
-
-    if rb.BitsLeftToRead() < 64 {
-        if err := rb.LoadMoreBytes(); err != nil {
+func (r *Reader) copyStored() error {
+    n := r.storedLeft
+    if n > stepSize {
+        n = stepSize
+    }
+    if n > 0 {
+        data, numBytesRead, err := r.rb.ReadAlignedBytes(n)
+        if err != nil {
             return err
         }
+        r.wb.WriteBytes(data)
+        r.storedLeft -= numBytesRead
     }
+    if r.storedLeft == 0 {
+        r.inBlock = false
+    }
+    return nil
+}
 
-    var prefix uint64
-    var err error
+func (r *Reader) decodeSymbols() error {
+    for i := 0 ; i < stepSize ; i++ {
+        if err := r.rb.ensureBits(1); err != nil {
+            return err
+        }
+        prefix, err := r.rb.Peek()
+        if err != nil {
+            return err
+        }
+        numBitsRead, isLiteral, litLen, distance, err := r.translator.decodePrefix(prefix)
+        if err != nil {
+            return r.rb.truncatedOr(err)
+        }
+        if err := r.rb.Forward(numBitsRead); err != nil {
+            return err
+        }
+        if isLiteral && litLen == 256 {
+            r.inBlock = false
+            return nil
+        }
+        if isLiteral {
+            err = r.wb.WriteByte(byte(litLen))
+        } else {
+            err = r.wb.RepeatBytes(litLen, distance)
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
 
-    isLastBlock := false
+// dynamicHeader is the progress in the header of a dynamic block.
+type dynamicHeader struct {
+    numLitLen int // zero before the counts are read
+    numDistance int
+    numCodeLengths int
+    codeLengthLengths [numCodeLengthCodes]int
+    numCodeLengthsRead int
+    codeLengthsReady bool // codeLengths is built
+}
 
-    for !isLastBlock {
-        // Read Deflate block header
-        if prefix, err = rb.Peek(); err != nil {
+// readDynamicHeader reads the code lengths of a dynamic block, themselves
+// encoded with a prefix code, as described in RFC 1951, section 3.2.7. The
+// lengths read are kept in r.lengths.
+func (r *Reader) readDynamicHeader() error {
+    rb := r.rb
+    h := &r.header
+    if h.numLitLen == 0 {
+        counts, err := rb.ReadBits(14)
+        if err != nil {
             return err
         }
-        if int(prefix >> 63) == 1 {
-            isLastBlock = true
+        numLitLen, numDistance := counts & 0x1f + 257, counts >> 5 & 0x1f + 1
+        if numLitLen > numLitLenCodes || numDistance > len(r.format.distance) {
+            return ErrInvalidCodeLengths
         }
-        // According to RFC 1951, "Data elements other than Huffman codes are
-        // packed starting with the least-significant bit of the data element".
-        // Because Peek() reverses the bits in the bytes, here the two bits of
-        // the compression mode need to be reversed again.
-        // The line below turns [b63 b62 b61 ... b2 b1 b0] into [0 0 0 ... b61 b62]
-        var compressionMode int = int(prefix >> 62) & 0x1 | int(prefix >> 60) & 0x2
-        rb.Forward(3)
-
-        fmt.Printf("Last block: %v, compression mode: %d\n", isLastBlock, compressionMode)
+        *h = dynamicHeader{numLitLen: numLitLen, numDistance: numDistance, numCodeLengths: counts >> 10 + 4}
+        r.lengths = r.lengths[:0]
+    }
 
-        // Decodes data based on compression mode
-        if compressionMode == DeflateNoCompression {
-            // From RFC 1951, 3.2.4. "Any bits of input up to
-            // the next byte boundary are ignored."
-            rb.Forward(uint(8 - rb.bitPosition))
+    for ; h.numCodeLengthsRead < h.numCodeLengths ; h.numCodeLengthsRead++ {
+        v, err := rb.ReadBits(3)
+        if err != nil {
+            return err
+        }
+        h.codeLengthLengths[codeLengthOrder[h.numCodeLengthsRead]] = v
+    }
+    if !h.codeLengthsReady {
+        if err := r.codeLengths.set(h.codeLengthLengths[:]); err != nil {
+            return err
+        }
+        h.codeLengthsReady = true
+    }
 
-            uncompressedHeader, _, err := rb.ReadAlignedBytes(4)
-            if err != nil {
+    total := h.numLitLen + h.numDistance
+    for len(r.lengths) < total {
+        if err := rb.ensureBits(1); err != nil {
+            return err
+        }
+        prefix, err := rb.Peek()
+        if err != nil {
+            return err
+        }
+        symbol, numBits := r.codeLengths.decode(prefix)
+        if symbol < 0 {
+            return rb.truncatedOr(ErrInvalidCodeLengths)
+        }
+        if symbol < 16 {
+            if err := rb.Forward(uint(numBits)); err != nil {
                 return err
             }
-
-            length := binary.LittleEndian.Uint16(uncompressedHeader[0:2])
-            lengthOneComplement := binary.LittleEndian.Uint16(uncompressedHeader[2:4])
-            if length != ^lengthOneComplement {
-                return errors.New("Found invalid length of block\n")
+            r.lengths = append(r.lengths, symbol)
+            continue
+        }
+        // Repeats of the previous length, or of zeros
+        length, minRepeat, extraBits := 0, 3, uint(2)
+        switch symbol {
+        case 16:
+            if len(r.lengths) == 0 {
+                return ErrInvalidCodeLengths
             }
+            length = r.lengths[len(r.lengths) - 1]
+        case 17:
+            extraBits = 3
+        case 18:
+            minRepeat, extraBits = 11, 7
+        }
+        // The code and its extra bits are read together
+        repeat := int(bits.Reverse64(prefix << uint(numBits)) & (1 << extraBits - 1)) + minRepeat
+        if err := rb.Forward(uint(numBits) + extraBits); err != nil {
+            return err
+        }
+        if len(r.lengths) + repeat > total {
+            return ErrInvalidCodeLengths
+        }
+        for ; repeat > 0 ; repeat-- {
+            r.lengths = append(r.lengths, length)
+        }
+    }
+    numLitLen := h.numLitLen
+    h.numLitLen = 0 // the next dynamic block starts with its counts
+    if r.lengths[endOfBlock] == 0 {
+        return ErrInvalidCodeLengths
+    }
+    return r.dynamic.set(r.lengths[:numLitLen], r.lengths[numLitLen:])
+}
 
-            if err := copyBytes(wb, rb, int(length)); err != nil {
-                return err
-            }
-        } else if compressionMode == DeflateReserved {
-            //
-        } else {
-            var translator *Translator
-            if compressionMode == DeflateFixed {
-                litLenSequence := GenerateMode2LitLenSequence()
-                distanceSequence := GenerateMode2DistanceSequence()
-                translator = NewTranslator(litLenSequence, distanceSequence)
-            } else if compressionMode == DeflateDynamic {
-                // 
-            }
 
-            hasMoreData := true
-            for hasMoreData {
-                if rb.BitsLeftToRead() < 64 {
-                    if err = rb.LoadMoreBytes(); err != nil {
-                        return err
-                    }
-                }
+// Checkpoint is a block boundary of a stream, where decoding can resume
+// with DecodeStreamDict, given the data before it.
+type Checkpoint struct {
+    BitOffset int64 // bits read from the ReadBuffer before the block
+    Offset int64 // bytes of data before the block
+    Window []byte // last WindowSize bytes of data before the block
+}
 
-                if prefix, err = rb.Peek(); err != nil {
-                    return err
-                }
+// DecodeStream decodes the DEFLATE stream at the current position of 'rb',
+// and writes its data to 'writer'.
+func DecodeStream(rb *ReadBuffer, writer io.Writer) error {
+    _, err := decodeStream(rb, writer, nil, 0, nil)
+    return err
+}
 
-                numBitsRead, isLiteral, litLen, distance, err := translator.decodePrefix(prefix)
-                if err != nil {
-                    return err
-                }
+// DecodeStreamDict is DecodeStream for a stream whose matches can refer to
+// 'window', as if it came before the data: a preset dictionary, or the data
+// before the Checkpoint the decoding resumes at.
+func DecodeStreamDict(rb *ReadBuffer, writer io.Writer, window []byte) error {
+    _, err := decodeStream(rb, writer, window, 0, nil)
+    return err
+}
 
-                if isLiteral {
-                    if litLen == 256 {
-                        hasMoreData = false
-                    } else {
-                        wb.WriteByte(byte(litLen))
-                    }
-                } else {
-                    wb.RepeatBytes(litLen, distance)
-                }
+// DecodeStreamCheckpoints is DecodeStream, and also appends to
+// 'checkpoints' the first block boundary after every 'span' bytes of data.
+func DecodeStreamCheckpoints(rb *ReadBuffer, writer io.Writer, span int64, checkpoints []Checkpoint) ([]Checkpoint, error) {
+    return decodeStream(rb, writer, nil, span, checkpoints)
+}
 
-                rb.Forward(numBitsRead)
-            }
+func decodeStream(rb *ReadBuffer, writer io.Writer, window []byte, span int64, checkpoints []Checkpoint) ([]Checkpoint, error) {
+    logging.Trace.Printf("DecodeStream()\n")
+    r := newReader(rb, writer, window, deflateFormat)
+    next := span
+    for {
+        if span > 0 && !r.inBlock && !r.lastBlock && r.wb.Len() >= next {
+            checkpoints = append(checkpoints, Checkpoint{rb.BitOffset(), r.wb.Len(), r.wb.Window()})
+            next = r.wb.Len() + span
+        }
+        if err := r.step(); err == io.EOF {
+            break
+        } else if err != nil {
+            return checkpoints, err
         }
     }
-
-    wb.Flush()
-    return nil
+    return checkpoints, r.wb.Flush()
 }
-
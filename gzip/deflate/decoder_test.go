@@ -3,6 +3,11 @@ package deflate
 import (
     "testing"
     "strconv"
+    "bytes"
+    "compress/flate"
+    "io"
+    "io/ioutil"
+    "testing/iotest"
     //"fmt"
 )
 
@@ -53,9 +58,191 @@ func TestGeneratorCanonicalPrefixesMode2(t *testing.T) {
 func TestStuff(t *testing.T) {
    litLenSequence := GenerateMode2LitLenSequence()
    distanceSequence := GenerateMode2DistanceSequence()
-   NewTranslator(litLenSequence, distanceSequence)
+   if _, err := NewTranslator(litLenSequence, distanceSequence); err == nil {
+       t.Errorf("The fixed distance code without its two unused codes is incomplete, and should be rejected")
+   }
    //tr := NewTranslator(litLenSequence, distanceSequence)
    //fmt.Printf("%#v\n", tr)
 }
 
 
+
+
+func stdlibCompress(t *testing.T, data []byte, level int, dict []byte) []byte {
+    var buf bytes.Buffer
+    w, err := flate.NewWriterDict(&buf, level, dict)
+    if err != nil {
+        t.Fatal(err)
+    }
+    w.Write(data)
+    w.Close()
+    return buf.Bytes()
+}
+
+func TestReaderStdlib(t *testing.T) {
+    inputs := [][]byte{[]byte{}, []byte("a"), testData(1000), testData(200000), mixedData(100000)}
+    for _, level := range []int{flate.NoCompression, flate.BestSpeed, flate.DefaultCompression, flate.BestCompression, flate.HuffmanOnly} {
+        for _, data := range inputs {
+            compressed := stdlibCompress(t, data, level, nil)
+            out, err := ioutil.ReadAll(NewReader(bytes.NewReader(compressed)))
+            if err != nil {
+                t.Fatalf("Level %d, %d bytes: %v", level, len(data), err)
+            }
+            if !bytes.Equal(out, data) {
+                t.Errorf("Level %d, %d bytes: the data does not round trip", level, len(data))
+            }
+        }
+    }
+}
+
+func TestReaderWriter(t *testing.T) {
+    data := mixedData(100000)
+    for _, level := range testLevels {
+        compressed := compress(t, data, level, len(data))
+        // One byte at a time, to reload the buffer everywhere
+        r := NewReader(iotest.OneByteReader(bytes.NewReader(compressed)))
+        out, err := ioutil.ReadAll(r)
+        if err != nil {
+            t.Fatalf("Level %d: %v", level, err)
+        }
+        if !bytes.Equal(out, data) {
+            t.Errorf("Level %d: the data does not round trip", level)
+        }
+    }
+}
+
+func TestDecodeStream(t *testing.T) {
+    data := testData(100000)
+    compressed := stdlibCompress(t, data, flate.DefaultCompression, nil)
+    var out bytes.Buffer
+    if err := DecodeStream(NewReadBuffer(bytes.NewReader(compressed), 4096), &out); err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(out.Bytes(), data) {
+        t.Errorf("The data does not round trip")
+    }
+}
+
+func TestReaderInvalid(t *testing.T) {
+    valid := stdlibCompress(t, testData(10000), flate.DefaultCompression, nil)
+    tests := []struct {
+        name string
+        data []byte
+        err error
+    }{
+        {"Reserved block type", []byte{0x07}, ErrInvalidBlockType},
+        {"Stored length", []byte{0x01, 0x05, 0x00, 0x00, 0x00}, ErrInvalidStoredLength},
+        // Fixed block with a match of length 3 at distance 1, first thing
+        {"Distance", []byte{0x03, 0x02, 0x00}, ErrInvalidDistance},
+        {"Truncated", valid[:len(valid) / 2], io.ErrUnexpectedEOF},
+        {"Empty", []byte{}, io.ErrUnexpectedEOF},
+    }
+    for _, test := range tests {
+        _, err := ioutil.ReadAll(NewReader(bytes.NewReader(test.data)))
+        if err != test.err {
+            t.Errorf("%s: expected %v, found %v", test.name, test.err, err)
+        }
+    }
+}
+
+func TestReaderDict(t *testing.T) {
+    dict := []byte(`{"id": 0, "name": "", "email": "", "active": true, "roles": ["user", "admin"]}`)
+    message := []byte(`{"id": 42, "name": "Ada", "email": "ada@example.com", "active": true, "roles": ["user"]}`)
+
+    var buf bytes.Buffer
+    w, err := NewWriterDict(&buf, DefaultCompression, dict)
+    if err != nil {
+        t.Fatal(err)
+    }
+    w.Write(message)
+    w.Close()
+    withDict := buf.Bytes()
+    without := compress(t, message, DefaultCompression, len(message))
+    if len(withDict) >= len(without) {
+        t.Errorf("The dictionary does not help: %d bytes, %d bytes without", len(withDict), len(without))
+    }
+
+    // Both ways with the standard library
+    out, err := ioutil.ReadAll(flate.NewReaderDict(bytes.NewReader(withDict), dict))
+    if err != nil || !bytes.Equal(out, message) {
+        t.Errorf("The standard library cannot read the data: %v", err)
+    }
+    for _, compressed := range [][]byte{withDict, stdlibCompress(t, message, flate.BestCompression, dict)} {
+        out, err = ioutil.ReadAll(NewReaderDict(bytes.NewReader(compressed), dict))
+        if err != nil || !bytes.Equal(out, message) {
+            t.Errorf("The data does not round trip: %v", err)
+        }
+    }
+}
+
+func TestReaderReset(t *testing.T) {
+    first, second := testData(30000), mixedData(30000)
+    r := NewReader(bytes.NewReader(stdlibCompress(t, first, flate.DefaultCompression, nil)))
+    // Stops in the middle of the first stream
+    io.ReadFull(r, make([]byte, 1000))
+    r.Reset(bytes.NewReader(stdlibCompress(t, second, flate.DefaultCompression, nil)))
+    out, err := ioutil.ReadAll(r)
+    if err != nil || !bytes.Equal(out, second) {
+        t.Errorf("The second stream does not round trip after Reset: %v", err)
+    }
+}
+
+// deflate64Stream returns a Deflate64 stream with a long length and a far
+// distance, which DEFLATE does not have, with its data.
+func deflate64Stream() ([]byte, []byte) {
+    data := testData(40000)
+    var buf bytes.Buffer
+    bw := newBitWriter(&buf)
+    bw.writeBits(0, 3)
+    bw.alignToByte()
+    bw.writeBits(uint64(len(data)), 16)
+    bw.writeBits(uint64(^len(data) & 0xffff), 16)
+    bw.writeBytes(data)
+
+    bw.writeBits(1, 1)
+    bw.writeBits(DeflateFixed, 2)
+    // Length 1003 at distance 40000, with the distance code 30
+    fixedLitLen.write(bw, 285)
+    bw.writeBits(1003 - 3, 16)
+    bw.writeBits(0x0f, 5) // reversed 30
+    bw.writeBits(40000 - 32769, 14)
+    data = append(data, data[:1003]...)
+    // Length 3000 at distance 1
+    fixedLitLen.write(bw, 285)
+    bw.writeBits(3000 - 3, 16)
+    bw.writeBits(0, 5)
+    data = append(data, bytes.Repeat(data[len(data) - 1:], 3000)...)
+    fixedLitLen.write(bw, endOfBlock)
+    bw.alignToByte()
+    bw.flush()
+    return buf.Bytes(), data
+}
+
+func TestDeflate64(t *testing.T) {
+    compressed, data := deflate64Stream()
+    out, err := ioutil.ReadAll(NewDeflate64Reader(iotest.OneByteReader(bytes.NewReader(compressed))))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(out, data) {
+        t.Errorf("The Deflate64 data does not match")
+    }
+
+    f := NewDeflate64Inflater()
+    out = out[:0]
+    for i := range compressed {
+        chunk, err := f.Decode(compressed[i:i + 1])
+        out = append(out, chunk...)
+        if err != nil && err != ErrNeedInput && err != io.EOF {
+            t.Fatal(err)
+        }
+    }
+    if !bytes.Equal(out, data) {
+        t.Errorf("The Deflate64 data does not match with the Inflater")
+    }
+
+    // The distance code 30 is not DEFLATE
+    if out, err := ioutil.ReadAll(NewReader(bytes.NewReader(compressed))) ; err == nil && bytes.Equal(out, data) {
+        t.Errorf("A DEFLATE reader decodes Deflate64")
+    }
+}
@@ -0,0 +1,712 @@
+package deflate
+
+import (
+    "errors"
+    "io"
+    "math/bits"
+
+    "github.com/goossaert/compression/huffman"
+    "github.com/goossaert/compression/lz77"
+)
+
+// Compression levels, as in zlib: 0 only stores the data, 1 to 3 use greedy
+// matching, and 4 to 9 lazy matching, searching harder and harder.
+// HuffmanOnly and RLE are the strategies of zlib with the same names: no
+// matches at all, or only matches with the previous byte. Optimal searches
+// much longer than level 9 for smaller output, as Zopfli does.
+const (
+    NoCompression = 0
+    BestSpeed = 1
+    BestCompression = 9
+    DefaultCompression = -1
+    HuffmanOnly = -2
+    RLE = -3
+    Optimal = -4
+)
+
+const (
+    WindowSize = 32768
+    MinMatch = 3
+    MaxMatch = 258
+    MaxStoredBlockSize = 65535
+
+    numLitLenCodes = 286
+    numDistanceCodes = 30
+    numCodeLengthCodes = 19
+    endOfBlock = 256
+
+    maxLitLenBits = 15
+    maxCodeLengthBits = 7
+
+    // Number of tokens per Huffman block
+    blockTokens = 1 << 14
+)
+
+var (
+    ErrInvalidLevel = errors.New("Invalid DEFLATE compression level")
+    ErrWriterClosed = errors.New("DEFLATE writer is closed")
+)
+
+// Search effort of each level, from the configuration table of zlib. Levels
+// 1 to 3 are greedy, so they have no lazy length.
+type levelConfig struct {
+    lazy int
+    nice int
+    chain int
+}
+
+var levelConfigs = []levelConfig{
+    {0, 0, 0},
+    {0, 8, 4},
+    {0, 16, 8},
+    {0, 32, 32},
+    {4, 16, 16},
+    {16, 32, 32},
+    {16, 128, 128},
+    {32, 128, 256},
+    {128, 258, 1024},
+    {258, 258, 4096},
+}
+
+// Order in which the code lengths of the code length alphabet are sent
+var codeLengthOrder = []int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+// Symbol for each match length and distance, from the tables of the decoder
+var lengthSymbols [MaxMatch + 1]translationItem
+var distanceSymbols [WindowSize + 1]translationItem
+
+func init() {
+    for _, item := range latLenTable {
+        for length := item.minRange ; length <= item.maxRange ; length++ {
+            lengthSymbols[length] = item
+        }
+    }
+    for _, item := range distanceTable {
+        for distance := item.minRange ; distance <= item.maxRange ; distance++ {
+            distanceSymbols[distance] = item
+        }
+    }
+}
+
+
+// encoding holds the codes of a Huffman code, bit-reversed for the bit
+// writer.
+type encoding struct {
+    codes []uint64
+    lengths []uint
+}
+
+func newEncoding(c *huffman.Code) encoding {
+    var e encoding
+    e.set(c)
+    return e
+}
+
+// set makes 'e' the encoding of 'c', reusing its memory.
+func (e *encoding) set(c *huffman.Code) {
+    if cap(e.codes) < c.Len() {
+        e.codes = make([]uint64, c.Len())
+        e.lengths = make([]uint, c.Len())
+    }
+    e.codes, e.lengths = e.codes[:c.Len()], e.lengths[:c.Len()]
+    for symbol := range e.codes {
+        code, nbits := c.Bits(symbol)
+        e.codes[symbol], e.lengths[symbol] = 0, 0
+        if nbits > 0 {
+            e.codes[symbol] = bits.Reverse64(code) >> uint(64 - nbits)
+            e.lengths[symbol] = uint(nbits)
+        }
+    }
+}
+
+func (e encoding) write(bw *bitWriter, symbol int) {
+    bw.writeBits(e.codes[symbol], e.lengths[symbol])
+}
+
+// Codes of the fixed blocks, from the code lengths of the decoder
+var fixedLitLenCode, fixedDistanceCode *huffman.Code
+var fixedLitLen, fixedDistance encoding
+
+func init() {
+    fixedLitLenCode, _ = huffman.NewCodeFromLengths(GenerateMode2LitLenSequence())
+    fixedLitLen = newEncoding(fixedLitLenCode)
+    fixedDistanceCode, _ = huffman.NewCodeFromLengths(GenerateMode2DistanceSequence())
+    fixedDistance = newEncoding(fixedDistanceCode)
+}
+
+
+// Writer compresses the data written to it as a DEFLATE stream. Except at
+// NoCompression, the tokens are split into blocks where their statistics
+// change, and each block is stored, fixed or dynamic, whichever is smallest.
+type Writer struct {
+    bw *bitWriter
+    level int
+    lz *lz77.Encoder // nil for NoCompression, HuffmanOnly and Optimal
+    tokens []lz77.Token
+    stored []byte // data of the next stored block
+    // Last WindowSize bytes of the blocks written, then the data of the
+    // next blocks: the chunk for Optimal, and the tokens once expanded for
+    // the other levels.
+    history []byte
+    windowLen int
+    dict []byte
+    // Memory of the last block split and written, reused by the next ones
+    splitter blockSplitter
+    block dynamicBlock
+    err error
+}
+
+func NewWriter(writer io.Writer, level int) (*Writer, error) {
+    if level == DefaultCompression {
+        level = 6
+    }
+    if level < Optimal || level > BestCompression {
+        return nil, ErrInvalidLevel
+    }
+    w := new(Writer)
+    w.bw = newBitWriter(writer)
+    w.level = level
+
+    switch {
+    case level == RLE:
+        opts := lz77.Options{WindowSize: WindowSize, MinMatch: MinMatch, MaxMatch: MaxMatch, MaxChain: 1}
+        w.lz, _ = lz77.NewEncoder(opts, rleFinder{opts})
+    case level >= BestSpeed:
+        config := levelConfigs[level]
+        opts := lz77.Options{WindowSize: WindowSize, MinMatch: MinMatch, MaxMatch: MaxMatch,
+                             MaxChain: config.chain, NiceLength: config.nice, LazyLength: config.lazy}
+        w.lz, _ = lz77.NewEncoder(opts, nil)
+    }
+    return w, nil
+}
+
+// NewWriterDict returns a writer whose matches can refer to the last
+// WindowSize bytes of 'dict', as if they came before the data. The data can
+// only be read back with the same dictionary, by NewReaderDict.
+func NewWriterDict(writer io.Writer, level int, dict []byte) (*Writer, error) {
+    w, err := NewWriter(writer, level)
+    if err != nil {
+        return nil, err
+    }
+    if len(dict) > WindowSize {
+        dict = dict[len(dict) - WindowSize:]
+    }
+    w.dict = dict
+    w.setDictionary()
+    return w, nil
+}
+
+func (w *Writer) setDictionary() {
+    if w.lz != nil {
+        w.lz.SetDictionary(w.dict)
+    }
+    w.history = append(w.history[:0], w.dict...)
+    w.windowLen = len(w.dict)
+}
+
+// Reset makes the writer write a new stream to 'writer', with the same
+// level and dictionary, reusing all its memory.
+func (w *Writer) Reset(writer io.Writer) {
+    w.bw.reset(writer)
+    w.tokens = w.tokens[:0]
+    w.stored = w.stored[:0]
+    if w.lz != nil {
+        w.lz.Reset()
+    }
+    w.setDictionary()
+    w.err = nil
+}
+
+// ResetDict is Reset with 'dict' as the dictionary instead of the previous
+// one, as if the writer came from NewWriterDict.
+func (w *Writer) ResetDict(writer io.Writer, dict []byte) {
+    if len(dict) > WindowSize {
+        dict = dict[len(dict) - WindowSize:]
+    }
+    w.dict = dict
+    w.Reset(writer)
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+    if w.err != nil {
+        return 0, w.err
+    }
+    n := len(p)
+    switch {
+    case w.level == NoCompression:
+        for len(p) > 0 {
+            size := MaxStoredBlockSize - len(w.stored)
+            if size > len(p) {
+                size = len(p)
+            }
+            w.stored = append(w.stored, p[:size]...)
+            p = p[size:]
+            if len(w.stored) == MaxStoredBlockSize {
+                w.writeStoredBlock(w.stored, false)
+                w.stored = w.stored[:0]
+            }
+        }
+    case w.level == Optimal:
+        for len(p) > 0 {
+            size := optimalChunkSize - (len(w.history) - w.windowLen)
+            if size > len(p) {
+                size = len(p)
+            }
+            w.history = append(w.history, p[:size]...)
+            p = p[size:]
+            if len(w.history) - w.windowLen == optimalChunkSize {
+                w.writeOptimalChunk(false)
+            }
+        }
+    case w.level == HuffmanOnly:
+        for _, b := range p {
+            w.tokens = append(w.tokens, lz77.LiteralToken(b))
+            if len(w.tokens) == blockTokens {
+                w.writeTokenBlocks(w.tokens, false)
+                w.tokens = w.tokens[:0]
+            }
+        }
+    default:
+        w.tokens = w.lz.Encode(w.tokens, p)
+        if len(w.tokens) >= blockTokens {
+            w.writeTokenBlocks(w.tokens, false)
+            w.tokens = w.tokens[:0]
+        }
+    }
+    if w.err = w.bw.flush(); w.err != nil {
+        return 0, w.err
+    }
+    return n, nil
+}
+
+// Close writes the last block. It does not close the underlying writer.
+func (w *Writer) Close() error {
+    if w.err == ErrWriterClosed {
+        return nil
+    }
+    if w.err != nil {
+        return w.err
+    }
+    w.writePending(true)
+    w.bw.alignToByte()
+    if w.err = w.bw.flush(); w.err != nil {
+        return w.err
+    }
+    w.err = ErrWriterClosed
+    return nil
+}
+
+// Flush writes the blocks of all the data written so far, then an empty
+// stored block, which ends on a byte boundary, as Z_SYNC_FLUSH in zlib. The
+// bytes written so far are then enough to decode all that data.
+func (w *Writer) Flush() error {
+    return w.flush(false)
+}
+
+// FullFlush is Flush, and also drops the data written so far, which the
+// next matches cannot refer to anymore, as Z_FULL_FLUSH in zlib. A reader
+// can start decoding at the bytes written after it.
+func (w *Writer) FullFlush() error {
+    return w.flush(true)
+}
+
+func (w *Writer) flush(full bool) error {
+    if w.err != nil {
+        return w.err
+    }
+    w.writePending(false)
+    w.writeStoredBlock(nil, false)
+    if full {
+        if w.lz != nil {
+            w.lz.Reset()
+        }
+        w.history = w.history[:0]
+        w.windowLen = 0
+    }
+    w.err = w.bw.flush()
+    return w.err
+}
+
+// writePending writes the blocks of the data not written yet, if any, or
+// an empty last block.
+func (w *Writer) writePending(final bool) {
+    if w.lz != nil {
+        w.tokens = w.lz.Flush(w.tokens)
+    }
+    switch {
+    case w.level == NoCompression:
+        if len(w.stored) > 0 || final {
+            w.writeStoredBlock(w.stored, final)
+            w.stored = w.stored[:0]
+        }
+    case w.level == Optimal && len(w.history) > w.windowLen:
+        w.writeOptimalChunk(final)
+    case len(w.tokens) > 0 || final:
+        w.writeTokenBlocks(w.tokens, final)
+        w.tokens = w.tokens[:0]
+    }
+}
+
+func (w *Writer) writeBlockHeader(blockType int, final bool) {
+    if final {
+        w.bw.writeBits(1, 1)
+    } else {
+        w.bw.writeBits(0, 1)
+    }
+    w.bw.writeBits(uint64(blockType), 2)
+}
+
+// writeTokenBlocks splits 'tokens' into blocks, and writes each of them.
+func (w *Writer) writeTokenBlocks(tokens []lz77.Token, final bool) {
+    points := append(w.splitter.split(tokens), len(tokens))
+    start := 0
+    for i, point := range points {
+        w.history, _ = lz77.Expand(w.history, tokens[start:point])
+        w.writeBlock(tokens[start:point], w.history[w.windowLen:], final && i == len(points) - 1)
+        w.slideHistory()
+        start = point
+    }
+}
+
+// slideHistory drops the data of the blocks written but the last
+// WindowSize bytes.
+func (w *Writer) slideHistory() {
+    keep := len(w.history)
+    if keep > WindowSize {
+        keep = WindowSize
+    }
+    w.windowLen = copy(w.history, w.history[len(w.history) - keep:])
+    w.history = w.history[:w.windowLen]
+}
+
+// writeBlock writes the tokens of 'data' in the smallest type of block.
+func (w *Writer) writeBlock(tokens []lz77.Token, data []byte, final bool) {
+    dynamic := &w.block
+    dynamic.set(tokens)
+    dynamicSize := dynamic.size(tokens)
+    fixedSize := fixedBlockSize(tokens)
+    storedSize := storedBlocksSize(len(data), w.bw.nbits)
+    switch {
+    case storedSize <= fixedSize && storedSize <= dynamicSize:
+        // Stored blocks have at most MaxStoredBlockSize bytes
+        for len(data) > MaxStoredBlockSize {
+            w.writeStoredBlock(data[:MaxStoredBlockSize], false)
+            data = data[MaxStoredBlockSize:]
+        }
+        w.writeStoredBlock(data, final)
+    case fixedSize <= dynamicSize:
+        w.writeFixedBlock(tokens, final)
+    default:
+        w.writeDynamicBlock(tokens, dynamic, final)
+    }
+}
+
+func (w *Writer) writeStoredBlock(data []byte, final bool) {
+    w.writeBlockHeader(DeflateNoCompression, final)
+    w.bw.alignToByte()
+    w.bw.writeBits(uint64(len(data)), 16)
+    w.bw.writeBits(uint64(^uint16(len(data))), 16)
+    w.bw.writeBytes(data)
+}
+
+func (w *Writer) writeFixedBlock(tokens []lz77.Token, final bool) {
+    w.writeBlockHeader(DeflateFixed, final)
+    w.writeTokens(tokens, fixedLitLen, fixedDistance)
+}
+
+func (w *Writer) writeDynamicBlock(tokens []lz77.Token, block *dynamicBlock, final bool) {
+    w.writeBlockHeader(DeflateDynamic, final)
+    w.bw.writeBits(uint64(block.numLitLen - 257), 5)
+    w.bw.writeBits(uint64(block.numDistance - 1), 5)
+    w.bw.writeBits(uint64(block.numCodeLengths - 4), 4)
+    for _, symbol := range codeLengthOrder[:block.numCodeLengths] {
+        _, nbits := block.codeLength.Bits(symbol)
+        w.bw.writeBits(uint64(nbits), 3)
+    }
+    block.codeLengthEncoding.set(&block.codeLength)
+    for i, symbol := range block.symbols {
+        block.codeLengthEncoding.write(w.bw, symbol)
+        if symbol >= 16 {
+            w.bw.writeBits(uint64(block.extras[i]), codeLengthExtraBits[symbol - 16])
+        }
+    }
+    block.litLenEncoding.set(&block.litLen)
+    block.distanceEncoding.set(&block.distance)
+    w.writeTokens(tokens, block.litLenEncoding, block.distanceEncoding)
+}
+
+func (w *Writer) writeTokens(tokens []lz77.Token, litLen encoding, distance encoding) {
+    for _, t := range tokens {
+        if t.IsLiteral() {
+            litLen.write(w.bw, int(t.Literal))
+            continue
+        }
+        item := lengthSymbols[t.Length]
+        litLen.write(w.bw, item.code)
+        w.bw.writeBits(uint64(t.Length - item.minRange), uint(item.numExtraBits))
+        item = distanceSymbols[t.Distance]
+        distance.write(w.bw, item.code)
+        w.bw.writeBits(uint64(t.Distance - item.minRange), uint(item.numExtraBits))
+    }
+    litLen.write(w.bw, endOfBlock)
+}
+
+// dynamicBlock holds the codes of a dynamic block and how its header
+// describes them. Its memory is reused when it is set to another block.
+type dynamicBlock struct {
+    litLen huffman.Code
+    distance huffman.Code
+    codeLength huffman.Code
+    numLitLen int
+    numDistance int
+    numCodeLengths int
+    // Code lengths of both codes, run-length encoded
+    symbols []int
+    extras []int
+
+    builder huffman.Builder
+    litLenFreqs [numLitLenCodes]uint64
+    distanceFreqs [numDistanceCodes]uint64
+    codeLengthFreqs [numCodeLengthCodes]uint64
+    lengths []int
+    litLenEncoding encoding
+    distanceEncoding encoding
+    codeLengthEncoding encoding
+}
+
+// Number of extra bits of the code length symbols 16, 17 and 18
+var codeLengthExtraBits = []uint{2, 3, 7}
+
+func newDynamicBlock(tokens []lz77.Token) *dynamicBlock {
+    block := new(dynamicBlock)
+    block.set(tokens)
+    return block
+}
+
+// set builds the codes of the block with 'tokens'.
+func (block *dynamicBlock) set(tokens []lz77.Token) {
+    countTokens(block.litLenFreqs[:], block.distanceFreqs[:], tokens)
+    block.builder.Build(&block.litLen, block.litLenFreqs[:], maxLitLenBits)
+    block.builder.Build(&block.distance, block.distanceFreqs[:], maxLitLenBits)
+
+    // The code lengths of both codes, without the unused codes at the end,
+    // are sent run-length encoded with the code length alphabet.
+    block.lengths = block.litLen.AppendLengths(block.lengths[:0])
+    block.numLitLen = lastUsed(block.lengths, 257)
+    block.lengths = block.distance.AppendLengths(block.lengths[:block.numLitLen])
+    block.numDistance = lastUsed(block.lengths[block.numLitLen:], 1)
+    block.lengths = block.lengths[:block.numLitLen + block.numDistance]
+    block.symbols, block.extras = runLengthEncode(block.symbols[:0], block.extras[:0], block.lengths)
+
+    codeLengthFreqs := block.codeLengthFreqs[:]
+    for i := range codeLengthFreqs {
+        codeLengthFreqs[i] = 0
+    }
+    for _, symbol := range block.symbols {
+        codeLengthFreqs[symbol] += 1
+    }
+    ensureTwoCodes(codeLengthFreqs)
+    block.builder.Build(&block.codeLength, codeLengthFreqs, maxCodeLengthBits)
+    block.numCodeLengths = 4
+    for i, symbol := range codeLengthOrder {
+        if _, nbits := block.codeLength.Bits(symbol) ; nbits > 0 && i + 1 > block.numCodeLengths {
+            block.numCodeLengths = i + 1
+        }
+    }
+}
+
+// size returns the number of bits of the block with 'tokens', header
+// included.
+func (block *dynamicBlock) size(tokens []lz77.Token) int {
+    n := 3 + 5 + 5 + 4 + 3 * block.numCodeLengths
+    for _, symbol := range block.symbols {
+        _, nbits := block.codeLength.Bits(symbol)
+        n += nbits
+        if symbol >= 16 {
+            n += int(codeLengthExtraBits[symbol - 16])
+        }
+    }
+    return n + tokensSize(tokens, &block.litLen, &block.distance)
+}
+
+// fixedBlockSize returns the number of bits of the fixed block with
+// 'tokens'.
+func fixedBlockSize(tokens []lz77.Token) int {
+    return 3 + tokensSize(tokens, fixedLitLenCode, fixedDistanceCode)
+}
+
+// storedBlocksSize returns the number of bits of the stored blocks with
+// 'length' bytes, the first one starting after 'nbits' bits of a byte.
+func storedBlocksSize(length int, nbits uint) int {
+    n := 0
+    for first := true ; first || length > 0 ; first = false {
+        // Header bits, padded to a byte, then LEN and NLEN
+        if first {
+            n += int(3 + nbits + 7) / 8 * 8 - int(nbits) + 32
+        } else {
+            n += 8 + 32
+        }
+        size := length
+        if size > MaxStoredBlockSize {
+            size = MaxStoredBlockSize
+        }
+        n += 8 * size
+        length -= size
+    }
+    return n
+}
+
+// tokensSize returns the number of bits of 'tokens' and of the end-of-block
+// symbol with the given codes.
+func tokensSize(tokens []lz77.Token, litLen *huffman.Code, distance *huffman.Code) int {
+    n := 0
+    for _, t := range tokens {
+        if t.IsLiteral() {
+            _, nbits := litLen.Bits(int(t.Literal))
+            n += nbits
+            continue
+        }
+        item := lengthSymbols[t.Length]
+        _, nbits := litLen.Bits(item.code)
+        n += nbits + item.numExtraBits
+        item = distanceSymbols[t.Distance]
+        _, nbits = distance.Bits(item.code)
+        n += nbits + item.numExtraBits
+    }
+    _, nbits := litLen.Bits(endOfBlock)
+    return n + nbits
+}
+
+// tokenFrequencies counts the literal/length and distance symbols of a
+// block, with its end-of-block symbol.
+func tokenFrequencies(tokens []lz77.Token) ([]uint64, []uint64) {
+    litLenFreqs := make([]uint64, numLitLenCodes)
+    distanceFreqs := make([]uint64, numDistanceCodes)
+    countTokens(litLenFreqs, distanceFreqs, tokens)
+    return litLenFreqs, distanceFreqs
+}
+
+// countTokens is tokenFrequencies, counting into the given slices.
+func countTokens(litLenFreqs []uint64, distanceFreqs []uint64, tokens []lz77.Token) {
+    for i := range litLenFreqs {
+        litLenFreqs[i] = 0
+    }
+    for i := range distanceFreqs {
+        distanceFreqs[i] = 0
+    }
+    for _, t := range tokens {
+        if t.IsLiteral() {
+            litLenFreqs[t.Literal] += 1
+        } else {
+            litLenFreqs[lengthSymbols[t.Length].code] += 1
+            distanceFreqs[distanceSymbols[t.Distance].code] += 1
+        }
+    }
+    litLenFreqs[endOfBlock] = 1
+    ensureTwoCodes(litLenFreqs)
+    ensureTwoCodes(distanceFreqs)
+}
+
+// ensureTwoCodes gives codes to unused symbols until at least two symbols
+// have one. zlib rejects a code with a single 1-bit code for the code
+// lengths, and needs at least one distance code, so zlib itself always
+// builds codes of two symbols or more.
+func ensureTwoCodes(freqs []uint64) {
+    used := 0
+    for _, freq := range freqs {
+        if freq > 0 {
+            used += 1
+        }
+    }
+    for symbol := 0 ; used < 2 ; symbol++ {
+        if freqs[symbol] == 0 {
+            freqs[symbol] = 1
+            used += 1
+        }
+    }
+}
+
+// lastUsed returns the number of code lengths up to the last non-zero one,
+// and at least 'min'.
+func lastUsed(lengths []int, min int) int {
+    n := len(lengths)
+    for n > min && lengths[n - 1] == 0 {
+        n -= 1
+    }
+    return n
+}
+
+// runLengthEncode encodes code lengths with the code length alphabet: 0 to
+// 15 are lengths, 16 repeats the previous length 3 to 6 times, 17 repeats a
+// zero length 3 to 10 times, and 18 11 to 138 times. The extra value of
+// each repeat symbol is its count minus the smallest count. The symbols and
+// extra values are appended to 'symbols' and 'extras'.
+func runLengthEncode(symbols []int, extras []int, lengths []int) ([]int, []int) {
+    for i := 0 ; i < len(lengths) ; {
+        length := lengths[i]
+        run := 1
+        for i + run < len(lengths) && lengths[i + run] == length {
+            run += 1
+        }
+        i += run
+
+        if length == 0 {
+            for run >= 11 {
+                n := run
+                if n > 138 {
+                    n = 138
+                }
+                symbols, extras = append(symbols, 18), append(extras, n - 11)
+                run -= n
+            }
+            if run >= 3 {
+                symbols, extras = append(symbols, 17), append(extras, run - 3)
+                run = 0
+            }
+        } else {
+            symbols, extras = append(symbols, length), append(extras, 0)
+            run -= 1
+            for run >= 3 {
+                n := run
+                if n > 6 {
+                    n = 6
+                }
+                symbols, extras = append(symbols, 16), append(extras, n - 3)
+                run -= n
+            }
+        }
+        for ; run > 0 ; run-- {
+            symbols, extras = append(symbols, length), append(extras, 0)
+        }
+    }
+    return symbols, extras
+}
+
+
+// rleFinder only finds matches with the previous byte, for the RLE
+// strategy.
+type rleFinder struct {
+    opts lz77.Options
+}
+
+func (f rleFinder) Matches(buf []byte, pos int, matches []lz77.Match) []lz77.Match {
+    if pos == 0 {
+        return matches
+    }
+    limit := len(buf) - pos
+    if limit > f.opts.MaxMatch {
+        limit = f.opts.MaxMatch
+    }
+    n := 0
+    for n < limit && buf[pos + n] == buf[pos - 1] {
+        n += 1
+    }
+    if n >= f.opts.MinMatch {
+        matches = append(matches, lz77.Match{Length: n, Distance: 1})
+    }
+    return matches
+}
+
+func (f rleFinder) Insert(buf []byte, pos int) {}
+func (f rleFinder) Slide(delta int) {}
+func (f rleFinder) Reset() {}
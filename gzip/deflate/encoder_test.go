@@ -0,0 +1,248 @@
+package deflate
+
+import (
+    "bytes"
+    "compress/flate"
+    "io"
+    "io/ioutil"
+    "math/rand"
+    "runtime"
+    "testing"
+)
+
+var testLevels = []int{NoCompression, 1, 2, 3, 4, 5, 6, 7, 8, 9, DefaultCompression, HuffmanOnly, RLE}
+
+func testData(size int) []byte {
+    r := rand.New(rand.NewSource(1))
+    words := []string{"the ", "deflate ", "stream ", "aaaaaaaa", "block ", "huffman ", "\n"}
+    var buf bytes.Buffer
+    for buf.Len() < size {
+        if r.Intn(10) == 0 {
+            buf.WriteByte(byte(r.Intn(256)))
+        } else {
+            buf.WriteString(words[r.Intn(len(words))])
+        }
+    }
+    return buf.Bytes()[:size]
+}
+
+func compress(t *testing.T, data []byte, level int, chunk int) []byte {
+    var buf bytes.Buffer
+    w, err := NewWriter(&buf, level)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for len(data) > 0 {
+        n := chunk
+        if n > len(data) {
+            n = len(data)
+        }
+        if _, err := w.Write(data[:n]); err != nil {
+            t.Fatal(err)
+        }
+        data = data[n:]
+    }
+    if err := w.Close(); err != nil {
+        t.Fatal(err)
+    }
+    return buf.Bytes()
+}
+
+func inflate(t *testing.T, compressed []byte) []byte {
+    out, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return out
+}
+
+func inflateStream(t *testing.T, compressed []byte) []byte {
+    var out bytes.Buffer
+    if err := DecodeStream(NewReadBuffer(bytes.NewReader(compressed), 4096), &out); err != nil {
+        t.Fatal(err)
+    }
+    return out.Bytes()
+}
+
+func TestWriterLevels(t *testing.T) {
+    inputs := [][]byte{[]byte{}, []byte("a"), []byte("aaaaaaaaaaaaaaaaaaaaaaaa"), testData(1000), testData(200000)}
+    for _, level := range testLevels {
+        for _, data := range inputs {
+            compressed := compress(t, data, level, len(data) + 1)
+            if out := inflate(t, compressed); !bytes.Equal(out, data) {
+                t.Errorf("Level %d, %d bytes: the data does not round trip", level, len(data))
+            }
+            if out := inflateStream(t, compressed); !bytes.Equal(out, data) {
+                t.Errorf("Level %d, %d bytes: the data does not round trip through DecodeStream", level, len(data))
+            }
+        }
+    }
+}
+
+func TestWriterChunks(t *testing.T) {
+    data := testData(100000)
+    for _, level := range []int{NoCompression, BestSpeed, DefaultCompression, HuffmanOnly} {
+        compressed := compress(t, data, level, 777)
+        if out := inflate(t, compressed); !bytes.Equal(out, data) {
+            t.Errorf("Level %d: the data written in chunks does not round trip", level)
+        }
+    }
+}
+
+func TestWriterRatio(t *testing.T) {
+    data := testData(200000)
+    sizes := make(map[int]int)
+    for _, level := range testLevels {
+        sizes[level] = len(compress(t, data, level, len(data)))
+    }
+    if sizes[NoCompression] < len(data) {
+        t.Errorf("Stored blocks are smaller than the data: %d bytes", sizes[NoCompression])
+    }
+    if sizes[BestCompression] > sizes[BestSpeed] {
+        t.Errorf("Level 9 is bigger than level 1: %d and %d bytes", sizes[BestCompression], sizes[BestSpeed])
+    }
+    if sizes[HuffmanOnly] <= sizes[BestSpeed] || sizes[HuffmanOnly] >= sizes[NoCompression] {
+        t.Errorf("HuffmanOnly should be between level 1 and no compression: %d bytes", sizes[HuffmanOnly])
+    }
+}
+
+func TestWriterInvalidLevel(t *testing.T) {
+    for _, level := range []int{-5, 10} {
+        if _, err := NewWriter(ioutil.Discard, level); err != ErrInvalidLevel {
+            t.Errorf("Level %d: expected ErrInvalidLevel, found %v", level, err)
+        }
+    }
+}
+
+func TestRunLengthEncode(t *testing.T) {
+    lengths := []int{8, 8, 8, 8, 8, 8, 8, 8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 0, 0}
+    symbols, extras := runLengthEncode(nil, nil, lengths)
+    expectedSymbols := []int{8, 16, 8, 18, 5, 0, 0}
+    expectedExtras := []int{0, 3, 0, 2, 0, 0, 0}
+    if len(symbols) != len(expectedSymbols) {
+        t.Fatalf("Expected symbols %v, found %v", expectedSymbols, symbols)
+    }
+    for i := range symbols {
+        if symbols[i] != expectedSymbols[i] || extras[i] != expectedExtras[i] {
+            t.Errorf("Expected symbols %v and extras %v, found %v and %v", expectedSymbols, expectedExtras, symbols, extras)
+            break
+        }
+    }
+}
+
+func TestWriterFlush(t *testing.T) {
+    data := testData(50000)
+    first, second := data[:20000], data[20000:]
+    for _, level := range testLevels {
+        var buf bytes.Buffer
+        w, _ := NewWriter(&buf, level)
+        w.Write(first)
+        if err := w.Flush(); err != nil {
+            t.Fatal(err)
+        }
+        flushed := buf.Bytes()
+        if !bytes.HasSuffix(flushed, []byte{0x00, 0x00, 0xff, 0xff}) {
+            t.Errorf("Level %d: the flush does not end with an empty stored block", level)
+        }
+        // The bytes written so far give all the data written so far
+        out := make([]byte, len(first))
+        if _, err := io.ReadFull(NewReader(bytes.NewReader(flushed)), out); err != nil || !bytes.Equal(out, first) {
+            t.Errorf("Level %d: the data before the flush cannot be read: %v", level, err)
+        }
+        w.Write(second)
+        w.Close()
+        if out := inflate(t, buf.Bytes()); !bytes.Equal(out, data) {
+            t.Errorf("Level %d: the data does not round trip", level)
+        }
+        // Through the empty stored block
+        if out, err := ioutil.ReadAll(NewReader(bytes.NewReader(buf.Bytes()))); err != nil || !bytes.Equal(out, data) {
+            t.Errorf("Level %d: the data does not round trip with Reader: %v", level, err)
+        }
+    }
+}
+
+func TestWriterFullFlush(t *testing.T) {
+    // The data after the flush repeats the data before, but cannot refer
+    // to it
+    first := testData(20000)
+    for _, level := range testLevels {
+        var buf bytes.Buffer
+        w, _ := NewWriter(&buf, level)
+        w.Write(first)
+        w.FullFlush()
+        offset := buf.Len()
+        w.Write(first)
+        w.Close()
+
+        out, err := ioutil.ReadAll(NewReader(bytes.NewReader(buf.Bytes()[offset:])))
+        if err != nil || !bytes.Equal(out, first) {
+            t.Errorf("Level %d: the data after the full flush cannot be read on its own: %v", level, err)
+        }
+        if out := inflate(t, buf.Bytes()); !bytes.Equal(out, append(first, first...)) {
+            t.Errorf("Level %d: the data does not round trip", level)
+        }
+    }
+}
+
+func TestWriterReset(t *testing.T) {
+    data := testData(50000)
+    dict := testData(70000)[60000:]
+    for _, level := range testLevels {
+        var first, second bytes.Buffer
+        w, _ := NewWriterDict(&first, level, dict)
+        w.Write(data)
+        w.Close()
+        // A reset writer writes the same stream as a new one
+        w.Reset(&second)
+        w.Write(data)
+        w.Close()
+        if !bytes.Equal(first.Bytes(), second.Bytes()) {
+            t.Errorf("Level %d: the streams before and after Reset differ", level)
+        }
+    }
+}
+
+// allocatedBytes returns the number of bytes 'f' allocates on average.
+func allocatedBytes(f func()) uint64 {
+    const runs = 20
+    f()
+    var before, after runtime.MemStats
+    runtime.ReadMemStats(&before)
+    for i := 0 ; i < runs ; i++ {
+        f()
+    }
+    runtime.ReadMemStats(&after)
+    return (after.TotalAlloc - before.TotalAlloc) / runs
+}
+
+func TestResetAllocations(t *testing.T) {
+    message := testData(2000)
+    out := make([]byte, len(message))
+    var compressed bytes.Buffer
+    roundTrip := func(w *Writer, r *Reader) {
+        w.Write(message)
+        w.Close()
+        io.ReadFull(r, out)
+    }
+    withNew := allocatedBytes(func() {
+        compressed.Reset()
+        w, _ := NewWriter(&compressed, DefaultCompression)
+        roundTrip(w, NewReader(&compressed))
+    })
+    w, _ := NewWriter(&compressed, DefaultCompression)
+    r := NewReader(&compressed)
+    withReset := allocatedBytes(func() {
+        compressed.Reset()
+        w.Reset(&compressed)
+        r.Reset(&compressed)
+        roundTrip(w, r)
+    })
+    // The buffers, the tables and the memory used to build the Huffman codes
+    // of the blocks are all reused
+    if withReset > 1024 {
+        t.Errorf("Reset writers and readers allocate %d bytes per message, new ones %d bytes", withReset, withNew)
+    }
+    if !bytes.Equal(out, message) {
+        t.Errorf("The data does not round trip")
+    }
+}
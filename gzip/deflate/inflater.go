@@ -0,0 +1,94 @@
+package deflate
+
+import (
+    "errors"
+    "io"
+)
+
+// Most bytes of data returned by one call to Decode, about
+const inflaterOutputSize = 65536
+
+var ErrNeedInput = errors.New("DEFLATE decoder needs more input")
+
+// Inflater decodes a stream given by chunks as they arrive, instead of
+// reading it, so that a single goroutine can decode many streams. A step of
+// the decoder missing input stops where it was, and goes on with the next
+// chunk.
+type Inflater struct {
+    r *Reader
+    input []byte // bytes given but not decoded yet
+    bitPosition int // bits of input[0] already decoded
+}
+
+func NewInflater() *Inflater {
+    return NewInflaterDict(nil)
+}
+
+// NewInflaterDict returns an inflater of the data compressed with the preset
+// dictionary 'dict', as NewWriterDict writes it.
+func NewInflaterDict(dict []byte) *Inflater {
+    f := new(Inflater)
+    f.r = newReader(new(ReadBuffer), nil, dict, deflateFormat)
+    return f
+}
+
+// NewDeflate64Inflater returns an inflater of a Deflate64 stream.
+func NewDeflate64Inflater() *Inflater {
+    f := new(Inflater)
+    f.r = newReader(new(ReadBuffer), nil, nil, deflate64Format)
+    return f
+}
+
+// Reset makes the inflater decode a new stream, with the same dictionary,
+// reusing all its memory.
+func (f *Inflater) Reset() {
+    f.r.Reset(nil)
+    f.input = f.input[:0]
+    f.bitPosition = 0
+}
+
+// Decode decodes the stream with 'in' appended to the input given so far,
+// and returns data, which is only valid until the next call. It returns
+// ErrNeedInput once all the input is decoded, io.EOF once the stream ends,
+// and nil when there is more data to return, with a next call that may give
+// no more input.
+func (f *Inflater) Decode(in []byte) ([]byte, error) {
+    r := f.r
+    if r.err != nil && r.err != ErrNeedInput {
+        if r.err == io.EOF {
+            f.input = append(f.input, in...)
+        }
+        return nil, r.err
+    }
+    f.input = append(f.input, in...)
+    r.rb.setBytes(f.input, f.bitPosition)
+    r.out.Reset()
+    r.err = nil
+    for r.err == nil && r.out.Len() < inflaterOutputSize {
+        r.err = r.step()
+        if err := r.wb.Flush(); err != nil && r.err == nil {
+            r.err = err
+        }
+    }
+    if r.err == io.ErrUnexpectedEOF {
+        r.err = ErrNeedInput
+    }
+    if r.err == io.EOF {
+        r.rb.AlignToByte()
+    }
+
+    // Drops the bytes decoded
+    n := copy(f.input, f.input[r.rb.index:])
+    f.input = f.input[:n]
+    f.bitPosition = r.rb.bitPosition
+    return r.out.Bytes(), r.err
+}
+
+// Remaining returns the bytes given after the end of the stream, once Decode
+// returned io.EOF.
+func (f *Inflater) Remaining() []byte {
+    if f.r.err != io.EOF {
+        return nil
+    }
+    return f.input
+}
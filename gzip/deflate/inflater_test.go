@@ -0,0 +1,83 @@
+package deflate
+
+import (
+    "bytes"
+    "io"
+    "math/rand"
+    "testing"
+)
+
+// inflateChunks decodes 'compressed' given by chunks of random sizes up to
+// 'maxChunk' bytes, and returns the data with the bytes not given.
+func inflateChunks(f *Inflater, compressed []byte, maxChunk int, rng *rand.Rand) ([]byte, []byte, error) {
+    var out []byte
+    for {
+        n := rng.Intn(maxChunk + 1)
+        if n > len(compressed) {
+            n = len(compressed)
+        }
+        chunk := compressed[:n]
+        compressed = compressed[n:]
+        for {
+            data, err := f.Decode(chunk)
+            chunk = nil
+            out = append(out, data...)
+            if err == ErrNeedInput {
+                if len(compressed) == 0 && n == 0 {
+                    return out, compressed, err
+                }
+                break
+            }
+            if err != nil {
+                return out, compressed, err
+            }
+        }
+    }
+}
+
+func TestInflater(t *testing.T) {
+    rng := rand.New(rand.NewSource(1))
+    data := mixedData(300000)
+    trailer := []byte("bytes after the stream")
+    f := NewInflater()
+    for _, level := range []int{0, 1, 6, 9} {
+        compressed := append(stdlibCompress(t, data, level, nil), trailer...)
+        for _, maxChunk := range []int{1, 7, 1000, 100000} {
+            f.Reset()
+            out, rest, err := inflateChunks(f, compressed, maxChunk, rng)
+            if err != io.EOF {
+                t.Fatalf("Level %d, chunks of %d: %v", level, maxChunk, err)
+            }
+            if !bytes.Equal(out, data) {
+                t.Errorf("Level %d, chunks of %d: the data does not round trip", level, maxChunk)
+            }
+            if remaining := append(f.Remaining(), rest...) ; !bytes.Equal(remaining, trailer) {
+                t.Errorf("Level %d, chunks of %d: wrong bytes after the stream", level, maxChunk)
+            }
+        }
+    }
+}
+
+func TestInflaterDict(t *testing.T) {
+    dict := testData(70000)[40000:]
+    data := testData(50000)
+    var buf bytes.Buffer
+    w, _ := NewWriterDict(&buf, 6, dict)
+    w.Write(data)
+    w.Close()
+    out, _, err := inflateChunks(NewInflaterDict(dict), buf.Bytes(), 100, rand.New(rand.NewSource(1)))
+    if err != io.EOF || !bytes.Equal(out, data) {
+        t.Errorf("The data does not round trip with a dictionary: %v", err)
+    }
+}
+
+func TestInflaterInvalid(t *testing.T) {
+    compressed := stdlibCompress(t, testData(20000), 6, nil)
+    rng := rand.New(rand.NewSource(1))
+    if _, _, err := inflateChunks(NewInflater(), compressed[:len(compressed) / 2], 10, rng) ; err != ErrNeedInput {
+        t.Errorf("Truncated stream: expected ErrNeedInput, found %v", err)
+    }
+    if _, _, err := inflateChunks(NewInflater(), []byte{0xff, 0xff, 0xff}, 10, rng) ; err != ErrInvalidBlockType {
+        t.Errorf("Invalid stream: expected ErrInvalidBlockType, found %v", err)
+    }
+}
@@ -0,0 +1,244 @@
+package deflate
+
+import (
+    "math"
+
+    "github.com/goossaert/compression/lz77"
+)
+
+const (
+    optimalChunkSize = 1 << 20
+    optimalIterations = 15
+    optimalMaxChain = 1024
+)
+
+// optimalMatch is an lz77.Match made small, as there is a list of them for
+// every position of a chunk.
+type optimalMatch struct {
+    length uint16
+    distance uint16
+}
+
+// costModel is the number of bits of each symbol, estimated from the
+// frequencies of the symbols.
+type costModel struct {
+    literal [256]float64
+    length [MaxMatch + 1]float64
+    distance [numDistanceCodes]float64
+}
+
+func newCostModel(litLenFreqs []uint64, distanceFreqs []uint64) *costModel {
+    m := new(costModel)
+    litLenBits := symbolBits(litLenFreqs)
+    distanceBits := symbolBits(distanceFreqs)
+    copy(m.literal[:], litLenBits)
+    for length := MinMatch ; length <= MaxMatch ; length++ {
+        item := lengthSymbols[length]
+        m.length[length] = litLenBits[item.code] + float64(item.numExtraBits)
+    }
+    for _, item := range distanceTable {
+        m.distance[item.code] = distanceBits[item.code] + float64(item.numExtraBits)
+    }
+    return m
+}
+
+// symbolBits returns the entropy of each symbol, -log2 of its probability.
+// Unused symbols count as used once, so that the parse can try them.
+func symbolBits(freqs []uint64) []float64 {
+    total := uint64(0)
+    for _, freq := range freqs {
+        total += freq
+    }
+    totalBits := math.Log2(float64(total + 1))
+    out := make([]float64, len(freqs))
+    for symbol, freq := range freqs {
+        if freq == 0 {
+            out[symbol] = totalBits
+        } else {
+            out[symbol] = totalBits - math.Log2(float64(freq))
+        }
+    }
+    return out
+}
+
+
+// optimalParser finds the matches of a chunk once, and parses its blocks.
+type optimalParser struct {
+    buf []byte // window before the chunk, then the chunk
+    start int // index of the chunk in buf
+    matches []optimalMatch // matches of all positions, by increasing length
+    offsets []int // index in 'matches' of the matches of each position
+    cost []float64
+    steps []optimalMatch // last step of the cheapest path to each position
+}
+
+func newOptimalParser(buf []byte, start int) *optimalParser {
+    p := new(optimalParser)
+    p.buf = buf
+    p.start = start
+
+    opts := lz77.Options{WindowSize: WindowSize, MinMatch: MinMatch, MaxMatch: MaxMatch, MaxChain: optimalMaxChain}
+    finder := lz77.NewBinaryTree(opts)
+    for pos := 0 ; pos < start ; pos++ {
+        finder.Insert(buf, pos)
+    }
+    var found []lz77.Match
+    p.offsets = make([]int, len(buf) - start + 1)
+    for pos := start ; pos < len(buf) ; pos++ {
+        p.offsets[pos - start] = len(p.matches)
+        found = finder.Matches(buf, pos, found[:0])
+        for _, m := range found {
+            p.matches = append(p.matches, optimalMatch{uint16(m.Length), uint16(m.Distance)})
+        }
+    }
+    p.offsets[len(buf) - start] = len(p.matches)
+    return p
+}
+
+func (p *optimalParser) matchesAt(pos int) []optimalMatch {
+    i := pos - p.start
+    return p.matches[p.offsets[i]:p.offsets[i + 1]]
+}
+
+// greedy appends to 'dst' the tokens of buf[start:end] taking the longest
+// match at each position.
+func (p *optimalParser) greedy(dst []lz77.Token, start int, end int) []lz77.Token {
+    for pos := start ; pos < end ; {
+        matches := p.matchesAt(pos)
+        if len(matches) > 0 {
+            m := matches[len(matches) - 1]
+            length := int(m.length)
+            if length > end - pos {
+                length = end - pos
+            }
+            if length >= MinMatch {
+                dst = append(dst, lz77.MatchToken(length, int(m.distance)))
+                pos += length
+                continue
+            }
+        }
+        dst = append(dst, lz77.LiteralToken(p.buf[pos]))
+        pos += 1
+    }
+    return dst
+}
+
+// parse returns the tokens of the cheapest path through buf[start:end]
+// with the costs of 'model'.
+func (p *optimalParser) parse(model *costModel, start int, end int) []lz77.Token {
+    n := end - start
+    if cap(p.cost) < n + 1 {
+        p.cost = make([]float64, n + 1)
+        p.steps = make([]optimalMatch, n + 1)
+    }
+    cost, steps := p.cost[:n + 1], p.steps[:n + 1]
+    cost[0] = 0
+    for i := 1 ; i <= n ; i++ {
+        cost[i] = math.Inf(1)
+    }
+
+    for i := 0 ; i < n ; i++ {
+        pos := start + i
+        if c := cost[i] + model.literal[p.buf[pos]] ; c < cost[i + 1] {
+            cost[i + 1] = c
+            steps[i + 1] = optimalMatch{1, 0}
+        }
+        // Each length can use the closest match at least as long
+        length := MinMatch
+        for _, m := range p.matchesAt(pos) {
+            distanceCost := cost[i] + model.distance[distanceSymbols[m.distance].code]
+            last := int(m.length)
+            if last > n - i {
+                last = n - i
+            }
+            for ; length <= last ; length++ {
+                if c := distanceCost + model.length[length] ; c < cost[i + length] {
+                    cost[i + length] = c
+                    steps[i + length] = optimalMatch{uint16(length), m.distance}
+                }
+            }
+        }
+    }
+
+    // The path is found backwards from the end
+    count := 0
+    for i := n ; i > 0 ; i -= int(steps[i].length) {
+        count += 1
+    }
+    tokens := make([]lz77.Token, count)
+    for i := n ; i > 0 ; i -= int(steps[i].length) {
+        count -= 1
+        if steps[i].length == 1 {
+            tokens[count] = lz77.LiteralToken(p.buf[start + i - 1])
+        } else {
+            tokens[count] = lz77.MatchToken(int(steps[i].length), int(steps[i].distance))
+        }
+    }
+    return tokens
+}
+
+// optimize returns the smallest tokens of buf[start:end] found in
+// optimalIterations parses. As in Zopfli, each parse is the cheapest path
+// through the literals and matches of every position, with the costs of the
+// symbols taken from the previous parse, the first one being greedy.
+func (p *optimalParser) optimize(start int, end int) []lz77.Token {
+    best := p.greedy(nil, start, end)
+    bestSize := blockSize(best)
+    tokens := best
+    for i := 0 ; i < optimalIterations ; i++ {
+        model := newCostModel(tokenFrequencies(tokens))
+        tokens = p.parse(model, start, end)
+        if size := blockSize(tokens) ; size < bestSize {
+            best, bestSize = tokens, size
+        }
+    }
+    return best
+}
+
+// blocks returns the tokens of each block of the chunk.
+func (p *optimalParser) blocks() [][]lz77.Token {
+    // Splits the chunk with the greedy parse, at the positions of the split
+    // tokens
+    greedy := p.greedy(nil, p.start, len(p.buf))
+    var bounds []int
+    pos, next := p.start, 0
+    for _, point := range splitTokens(greedy) {
+        for ; next < point ; next++ {
+            pos += tokenLength(greedy[next])
+        }
+        bounds = append(bounds, pos)
+    }
+    bounds = append(bounds, len(p.buf))
+
+    var blocks [][]lz77.Token
+    start := p.start
+    for _, end := range bounds {
+        blocks = append(blocks, p.optimize(start, end))
+        start = end
+    }
+    return blocks
+}
+
+func tokenLength(t lz77.Token) int {
+    if t.IsLiteral() {
+        return 1
+    }
+    return t.Length
+}
+
+
+// writeOptimalChunk compresses the data after the window, and keeps the
+// last WindowSize bytes as the window of the next chunk.
+func (w *Writer) writeOptimalChunk(final bool) {
+    blocks := newOptimalParser(w.history, w.windowLen).blocks()
+    start := w.windowLen
+    for i, tokens := range blocks {
+        end := start
+        for _, t := range tokens {
+            end += tokenLength(t)
+        }
+        w.writeBlock(tokens, w.history[start:end], final && i == len(blocks) - 1)
+        start = end
+    }
+    w.slideHistory()
+}
@@ -0,0 +1,28 @@
+package deflate
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestOptimalRoundTrip(t *testing.T) {
+    inputs := [][]byte{[]byte{}, []byte("a"), bytes.Repeat([]byte("ab"), 1000), testData(30000)}
+    for _, data := range inputs {
+        compressed := compress(t, data, Optimal, len(data) + 1)
+        if out := inflate(t, compressed); !bytes.Equal(out, data) {
+            t.Errorf("%d bytes: the data does not round trip", len(data))
+        }
+        if out := inflateStream(t, compressed); !bytes.Equal(out, data) {
+            t.Errorf("%d bytes: the data does not round trip through DecodeStream", len(data))
+        }
+    }
+}
+
+func TestOptimalRatio(t *testing.T) {
+    data := testData(30000)
+    optimal := len(compress(t, data, Optimal, len(data)))
+    best := len(compress(t, data, BestCompression, len(data)))
+    if optimal >= best {
+        t.Errorf("Optimal is not smaller than level 9: %d and %d bytes", optimal, best)
+    }
+}
@@ -4,7 +4,6 @@ import (
     "io"
     "errors"
     "math/bits"
-    "fmt"
 )
 
 type ReadBuffer struct {
@@ -13,6 +12,8 @@ type ReadBuffer struct {
     numBytesLoaded int
     index int
     bitPosition int
+    eof bool // the reader has no more bytes
+    consumed int64 // bytes dropped from the start of 'buf'
 }
 
 func NewReadBuffer(reader io.Reader, bufferSize int) *ReadBuffer {
@@ -26,6 +27,28 @@ func NewReadBuffer(reader io.Reader, bufferSize int) *ReadBuffer {
     return rb
 }
 
+// Reset makes the buffer read from 'reader', as if it were new.
+func (rb *ReadBuffer) Reset(reader io.Reader) {
+    rb.reader = reader
+    rb.numBytesLoaded = 0
+    rb.index = 0
+    rb.bitPosition = 0
+    rb.eof = false
+    rb.consumed = 0
+}
+
+// setBytes makes the buffer read 'buf' and nothing after it, starting at
+// its bit 'bitPosition'.
+func (rb *ReadBuffer) setBytes(buf []byte, bitPosition int) {
+    rb.buf = buf
+    rb.reader = nil
+    rb.numBytesLoaded = len(buf)
+    rb.index = 0
+    rb.bitPosition = bitPosition
+    rb.eof = true
+    rb.consumed = 0
+}
+
 func (rb *ReadBuffer) BitsLeftToRead() int {
     return rb.numBytesLoaded * 8 - (rb.index * 8 + rb.bitPosition)
 }
@@ -34,9 +57,13 @@ func (rb *ReadBuffer) LoadMoreBytes() error {
     var numBytesRemaining = rb.numBytesLoaded - rb.index
     copy(rb.buf[0:numBytesRemaining], rb.buf[rb.index:rb.index+numBytesRemaining])
     rb.numBytesLoaded = numBytesRemaining
+    rb.consumed += int64(rb.index)
     n, err := rb.reader.Read(rb.buf[rb.numBytesLoaded:len(rb.buf)])
     rb.numBytesLoaded += n
     rb.index = 0
+    if err == io.EOF {
+        rb.eof = true
+    }
     if err != nil && err != io.EOF {
         return err
     } else {
@@ -64,10 +91,74 @@ func (rb *ReadBuffer) ReadBit() (bool, error) {
 }
 */
 
+// ensureBits loads more bytes while fewer than 64 bits are left, and
+// returns io.ErrUnexpectedEOF if fewer than 'n' bits are left after that.
+func (rb *ReadBuffer) ensureBits(n int) error {
+    for rb.BitsLeftToRead() < 64 && !rb.eof {
+        if err := rb.LoadMoreBytes(); err != nil {
+            return err
+        }
+    }
+    if rb.BitsLeftToRead() < n {
+        return io.ErrUnexpectedEOF
+    }
+    return nil
+}
+
+// ReadBits reads an 'n'-bit number packed starting with its
+// least-significant bit, as RFC 1951 packs all the data elements other than
+// Huffman codes.
+func (rb *ReadBuffer) ReadBits(n uint) (int, error) {
+    if err := rb.ensureBits(int(n)); err != nil {
+        return 0, err
+    }
+    prefix, err := rb.Peek()
+    if err != nil {
+        return 0, err
+    }
+    v := int(bits.Reverse64(prefix) & (1 << n - 1))
+    return v, rb.Forward(n)
+}
+
+// Number of bits of the longest symbol with its extra bits: a length and a
+// distance of Deflate64
+const maxSymbolBits = 15 + 16 + 15 + 14
+
+// truncatedOr returns io.ErrUnexpectedEOF if the reader ends within
+// maxSymbolBits, as 'err' may then come from decoding the zeros past its
+// end, and 'err' otherwise.
+func (rb *ReadBuffer) truncatedOr(err error) error {
+    if rb.eof && rb.BitsLeftToRead() < maxSymbolBits {
+        return io.ErrUnexpectedEOF
+    }
+    return err
+}
+
+// BitOffset returns the number of bits read since the buffer was created or
+// reset.
+func (rb *ReadBuffer) BitOffset() int64 {
+    return (rb.consumed + int64(rb.index)) * 8 + int64(rb.bitPosition)
+}
+
+// AtEOF reports whether all the bytes of the reader have been read.
+func (rb *ReadBuffer) AtEOF() (bool, error) {
+    if err := rb.ensureBits(0); err != nil {
+        return false, err
+    }
+    return rb.BitsLeftToRead() <= 0, nil
+}
+
+// AlignToByte skips the bits left in the current byte.
+func (rb *ReadBuffer) AlignToByte() {
+    if rb.bitPosition > 0 {
+        rb.index += 1
+        rb.bitPosition = 0
+    }
+}
+
 func (rb *ReadBuffer) ReadAlignedByte() (byte, error) {
-    fmt.Printf("RB.ReadAlignedByte() index %d, bitPosition %d, numBytesLoaded %d\n", rb.index, rb.bitPosition, rb.numBytesLoaded)
-    if rb.index >= rb.numBytesLoaded {
-        return 0, errors.New("Index is out of bound.")
+    if err := rb.ensureBits(8); err != nil {
+        return 0, err
     }
     rb.bitPosition = 0
     out := rb.buf[rb.index]
@@ -76,10 +167,11 @@ func (rb *ReadBuffer) ReadAlignedByte() (byte, error) {
 }
 
 
+// ReadAlignedBytes reads up to 'n' bytes, as many as the buffer holds once
+// loaded.
 func (rb *ReadBuffer) ReadAlignedBytes(n int) ([]byte, int, error) {
-    fmt.Printf("RB.ReadAlignedBytes() index %d, bitPosition %d, numBytesLoaded %d\n", rb.index, rb.bitPosition, rb.numBytesLoaded)
-    if rb.index >= rb.numBytesLoaded {
-        return nil, 0, errors.New("Index is out of bound.")
+    if err := rb.ensureBits(8); err != nil {
+        return nil, 0, err
     }
     rb.bitPosition = 0
     numBytesRemaining := rb.numBytesLoaded - rb.index
@@ -94,7 +186,6 @@ func (rb *ReadBuffer) ReadAlignedBytes(n int) ([]byte, int, error) {
 
 
 func (rb *ReadBuffer) Peek() (uint64, error) {
-    fmt.Printf("RB.Peek() index %d, bitPosition %d, numBytesLoaded %d\n", rb.index, rb.bitPosition, rb.numBytesLoaded)
     if rb.index >= rb.numBytesLoaded {
         return 0, errors.New("Index is out of bound.")
     }
@@ -109,9 +200,8 @@ func (rb *ReadBuffer) Peek() (uint64, error) {
 
 func (rb *ReadBuffer) Forward(n uint) error {
     bitIndex := rb.index * 8 + rb.bitPosition + int(n)
-    fmt.Printf("RB.Forward() Before %d %d, After %d %d\n", rb.index, rb.bitPosition, int(bitIndex/8), int(bitIndex%8))
     if bitIndex > rb.numBytesLoaded * 8 {
-        return errors.New("Number of bits to forward is too large: cannot forward to a position after the end of the buffer.")
+        return io.ErrUnexpectedEOF
     }
     rb.index = int(bitIndex / 8)
     rb.bitPosition = bitIndex % 8
@@ -220,8 +310,11 @@ func BytesToUint64WithBitReversal(array []byte, bitOffset int) uint64{
     out = bits.Reverse64(out)
     // 'out' turned into [a0...a7][b0...b7] ... [h0...h7]
 
-    if len(array) > 8 && bitOffset > 0 {
-        out = (out << uint(bitOffset)) | (uint64(bits.Reverse8(array[8])) >> uint(8-bitOffset))
+    if bitOffset > 0 {
+        out = out << uint(bitOffset)
+        if len(array) > 8 {
+            out |= uint64(bits.Reverse8(array[8])) >> uint(8-bitOffset)
+        }
     }
 
     // example with bitOffset=6
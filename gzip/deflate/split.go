@@ -0,0 +1,189 @@
+package deflate
+
+import (
+    "math"
+    "sort"
+
+    "github.com/goossaert/compression/lz77"
+)
+
+const (
+    maxBlocks = 15
+    maxSplitPoints = 64
+    minSplitStride = 64
+)
+
+// tokenHistogram counts the symbols of some tokens, with the number of
+// extra bits and the length of the data they stand for.
+type tokenHistogram struct {
+    litLen [numLitLenCodes]int
+    distance [numDistanceCodes]int
+    extraBits int
+    length int
+}
+
+func (h *tokenHistogram) add(t lz77.Token) {
+    if t.IsLiteral() {
+        h.litLen[t.Literal] += 1
+        h.length += 1
+        return
+    }
+    item := lengthSymbols[t.Length]
+    h.litLen[item.code] += 1
+    h.extraBits += item.numExtraBits
+    item = distanceSymbols[t.Distance]
+    h.distance[item.code] += 1
+    h.extraBits += item.numExtraBits
+    h.length += t.Length
+}
+
+// diff sets 'h' to the counts of the tokens counted in 'a' but not in 'b'.
+func (h *tokenHistogram) diff(a *tokenHistogram, b *tokenHistogram) {
+    for i := range h.litLen {
+        h.litLen[i] = a.litLen[i] - b.litLen[i]
+    }
+    for i := range h.distance {
+        h.distance[i] = a.distance[i] - b.distance[i]
+    }
+    h.extraBits = a.extraBits - b.extraBits
+    h.length = a.length - b.length
+}
+
+// estimate returns about the size in bits of the smallest block with the
+// tokens. A dynamic block takes the entropy of the symbols, and about 4 bits
+// of header for each symbol used.
+func (h *tokenHistogram) estimate() float64 {
+    h.litLen[endOfBlock] += 1
+    dynamic := float64(3 + 14 + 3 * numCodeLengthCodes + h.extraBits)
+    fixed := float64(3 + h.extraBits)
+    for _, counts := range [][]int{h.litLen[:], h.distance[:]} {
+        total := 0
+        for _, count := range counts {
+            total += count
+        }
+        for _, count := range counts {
+            if count > 0 {
+                dynamic += float64(count) * math.Log2(float64(total) / float64(count)) + 4
+            }
+        }
+    }
+    for symbol, count := range h.litLen {
+        _, nbits := fixedLitLenCode.Bits(symbol)
+        fixed += float64(count * nbits)
+    }
+    for symbol, count := range h.distance {
+        _, nbits := fixedDistanceCode.Bits(symbol)
+        fixed += float64(count * nbits)
+    }
+    h.litLen[endOfBlock] -= 1
+    stored := float64(storedBlocksSize(h.length, 0))
+    return math.Min(dynamic, math.Min(fixed, stored))
+}
+
+
+// splitTokens returns the indices of the tokens starting a new block, in
+// increasing order. As in Zopfli, the tokens are split in two where the
+// estimated sizes of both halves add up to the least, then the biggest block
+// left is split again, until no split saves bits or there are maxBlocks.
+func splitTokens(tokens []lz77.Token) []int {
+    return new(blockSplitter).split(tokens)
+}
+
+// blockSplitter splits tokens as splitTokens does, and keeps its
+// histograms from one split to the next.
+type blockSplitter struct {
+    cumulated []tokenHistogram
+    running tokenHistogram
+    h tokenHistogram
+    segments []splitSegment
+    points []int
+}
+
+type splitSegment struct {
+    start int
+    end int
+    done bool
+}
+
+// cost returns the estimated size of the tokens from the place 'start' to
+// the place 'end'.
+func (s *blockSplitter) cost(start int, end int) float64 {
+    s.h.diff(&s.cumulated[end], &s.cumulated[start])
+    return s.h.estimate()
+}
+
+// split returns the indices of the tokens starting a new block. They are
+// only valid until the next split.
+func (s *blockSplitter) split(tokens []lz77.Token) []int {
+    stride := (len(tokens) + maxSplitPoints - 1) / maxSplitPoints
+    if stride < minSplitStride {
+        stride = minSplitStride
+    }
+    s.points = s.points[:0]
+    if len(tokens) < 2 * stride {
+        return s.points
+    }
+    // Histograms of the tokens before each place a block can start, and of
+    // all of them
+    numPlaces := (len(tokens) + stride - 1) / stride
+    if cap(s.cumulated) < numPlaces + 1 {
+        s.cumulated = make([]tokenHistogram, numPlaces + 1)
+    }
+    s.cumulated = s.cumulated[:numPlaces + 1]
+    s.cumulated[0] = tokenHistogram{}
+    s.running = tokenHistogram{}
+    for i, t := range tokens {
+        s.running.add(t)
+        if (i + 1) % stride == 0 || i + 1 == len(tokens) {
+            s.cumulated[(i + stride) / stride] = s.running
+        }
+    }
+
+    segments := append(s.segments[:0], splitSegment{0, numPlaces, false})
+    for len(segments) < maxBlocks {
+        // Splits the biggest block that may still gain from it
+        biggest := -1
+        for i, seg := range segments {
+            if !seg.done && (biggest < 0 || seg.end - seg.start > segments[biggest].end - segments[biggest].start) {
+                biggest = i
+            }
+        }
+        if biggest < 0 {
+            break
+        }
+        seg := segments[biggest]
+        best, bestCost := -1, s.cost(seg.start, seg.end)
+        for point := seg.start + 1 ; point < seg.end ; point++ {
+            if c := s.cost(seg.start, point) + s.cost(point, seg.end) ; c < bestCost {
+                best, bestCost = point, c
+            }
+        }
+        if best < 0 {
+            segments[biggest].done = true
+            continue
+        }
+        s.points = append(s.points, best * stride)
+        segments[biggest] = splitSegment{seg.start, best, false}
+        segments = append(segments, splitSegment{best, seg.end, false})
+    }
+    s.segments = segments
+    sort.Ints(s.points)
+    return s.points
+}
+
+// blockSize returns the size in bits of the smallest block with 'tokens',
+// starting on a byte boundary.
+func blockSize(tokens []lz77.Token) int {
+    size := newDynamicBlock(tokens).size(tokens)
+    if fixed := fixedBlockSize(tokens) ; fixed < size {
+        size = fixed
+    }
+    length := 0
+    for _, t := range tokens {
+        length += tokenLength(t)
+    }
+    if stored := storedBlocksSize(length, 0) ; stored < size {
+        size = stored
+    }
+    return size
+}
@@ -0,0 +1,61 @@
+package deflate
+
+import (
+    "bytes"
+    "math/rand"
+    "testing"
+)
+
+func mixedData(size int) []byte {
+    r := rand.New(rand.NewSource(1))
+    data := testData(size / 2)
+    for len(data) < size {
+        data = append(data, byte(r.Intn(256)))
+    }
+    return data
+}
+
+func TestSplitTokens(t *testing.T) {
+    // Text then random bytes: two blocks are smaller than one
+    data := mixedData(40000)
+    p := newOptimalParser(data, 0)
+    tokens := p.greedy(nil, 0, len(data))
+    points := splitTokens(tokens)
+    if len(points) == 0 {
+        t.Fatalf("Tokens were not split")
+    }
+    size := 0
+    start := 0
+    for _, point := range append(points, len(tokens)) {
+        size += blockSize(tokens[start:point])
+        start = point
+    }
+    if size >= blockSize(tokens) {
+        t.Errorf("Split blocks are not smaller: %d bits instead of %d", size, blockSize(tokens))
+    }
+}
+
+func TestBlockTypes(t *testing.T) {
+    // Random data is stored, with 5 bytes of header per block
+    data := mixedData(200000)[100000:]
+    if size := len(compress(t, data, DefaultCompression, len(data))); size > len(data) + 5 * 3 {
+        t.Errorf("Random data is not stored: %d bytes instead of %d", size, len(data))
+    }
+    // A single byte fits in a fixed block, as zlib does
+    if size := len(compress(t, []byte("a"), DefaultCompression, 1)); size != 3 {
+        t.Errorf("A single byte is not in a fixed block: %d bytes", size)
+    }
+    // Text then random data costs about the text alone, then the data
+    data = mixedData(200000)
+    text := len(compress(t, data[:100000], DefaultCompression, 100000))
+    mixed := compress(t, data, DefaultCompression, len(data))
+    if len(mixed) > text + 100000 + 1000 {
+        t.Errorf("Mixed data takes %d bytes, the text alone takes %d", len(mixed), text)
+    }
+    if out := inflate(t, mixed); !bytes.Equal(out, data) {
+        t.Errorf("Mixed data does not round trip")
+    }
+    if out := inflateStream(t, mixed); !bytes.Equal(out, data) {
+        t.Errorf("Mixed data does not round trip through DecodeStream")
+    }
+}
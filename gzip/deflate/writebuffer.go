@@ -1,15 +1,23 @@
 package deflate
 
 import (
+    "errors"
     "io"
-    "fmt"
 )
 
+var ErrInvalidDistance = errors.New("DEFLATE match distance is beyond the data")
+
+// WriteBuffer keeps at least the last 'baseSize' bytes written, for matches
+// to copy them. The bytes are written out when the buffer is full, and on
+// Flush.
 type WriteBuffer struct {
     writer io.Writer
     buf []byte
     index int
+    flushed int // bytes of 'buf' already written out
     baseSize int
+    total int64 // bytes written since the last reset
+    err error
 }
 
 func NewWriteBuffer(writer io.Writer, baseSize int) *WriteBuffer {
@@ -21,10 +29,31 @@ func NewWriteBuffer(writer io.Writer, baseSize int) *WriteBuffer {
     return wb
 }
 
-func (wb *WriteBuffer) WriteByte(b byte) {
+// Reset makes the buffer write to 'writer', as if it were new.
+func (wb *WriteBuffer) Reset(writer io.Writer) {
+    wb.writer = writer
+    wb.index = 0
+    wb.flushed = 0
+    wb.total = 0
+    wb.err = nil
+}
+
+// SetDictionary makes the last 'baseSize' bytes of 'dict' the data that
+// the matches can copy first. They are not written out.
+func (wb *WriteBuffer) SetDictionary(dict []byte) {
+    if len(dict) > wb.baseSize {
+        dict = dict[len(dict) - wb.baseSize:]
+    }
+    wb.index = copy(wb.buf, dict)
+    wb.flushed = wb.index
+}
+
+func (wb *WriteBuffer) WriteByte(b byte) error {
     wb.rotateIfNeeded()
     wb.buf[wb.index] = b
     wb.index += 1
+    wb.total += 1
+    return wb.err
 }
 
 func (wb *WriteBuffer) WriteBytes(source []byte) {
@@ -37,32 +66,68 @@ func (wb *WriteBuffer) WriteBytes(source []byte) {
         }
         copy(wb.buf[wb.index:wb.index+step], source[i:i+step])
         wb.index += step
+        wb.total += int64(step)
         i += step
     }
 }
 
-func (wb *WriteBuffer) RepeatBytes(length int, distance int) {
-    fmt.Printf("WB.RepeatBytes() %d %d\n", length, distance)
+// RepeatBytes copies 'length' bytes from 'distance' bytes back. When the
+// distance is shorter than the length, the copy repeats the bytes it
+// produces.
+func (wb *WriteBuffer) RepeatBytes(length int, distance int) error {
     wb.rotateIfNeeded()
-    copy(wb.buf[wb.index:wb.index+length], wb.buf[wb.index-distance:wb.index-distance+length])
-    wb.index += length
+    if distance < 1 || distance > wb.index {
+        return ErrInvalidDistance
+    }
+    for length > 0 {
+        // Deflate64 lengths may be longer than the room left in 'buf'
+        wb.rotateIfNeeded()
+        step := length
+        if step > wb.baseSize {
+            step = wb.baseSize
+        }
+        start := wb.index - distance
+        n := copy(wb.buf[wb.index:wb.index+step], wb.buf[start:wb.index])
+        wb.index += n
+        wb.total += int64(n)
+        length -= n
+    }
+    return wb.err
 }
 
+// Len returns the number of bytes written, not counting the dictionary.
+func (wb *WriteBuffer) Len() int64 {
+    return wb.total
+}
+
+// Window returns a copy of the last 'baseSize' bytes written, or of the
+// dictionary for the ones before the first.
+func (wb *WriteBuffer) Window() []byte {
+    start := wb.index - wb.baseSize
+    if start < 0 {
+        start = 0
+    }
+    return append([]byte(nil), wb.buf[start:wb.index]...)
+}
+
+// Flush writes out all the bytes not written yet, and keeps them for the
+// matches.
 func (wb *WriteBuffer) Flush() (error) {
-    if _, err := wb.writer.Write(wb.buf[:wb.index]); err != nil {
-        return err
+    if wb.err == nil && wb.index > wb.flushed {
+        _, wb.err = wb.writer.Write(wb.buf[wb.flushed:wb.index])
     }
-    wb.index = 0
-    return nil
+    wb.flushed = wb.index
+    return wb.err
 }
 
 func (wb *WriteBuffer) rotateIfNeeded() {
     if wb.index > wb.baseSize * 2 {
-        if _, err := wb.writer.Write(wb.buf[:wb.baseSize]); err != nil {
-            //panic
+        if wb.err == nil && wb.flushed < wb.baseSize {
+            _, wb.err = wb.writer.Write(wb.buf[wb.flushed:wb.baseSize])
+            wb.flushed = wb.baseSize
         }
         copy(wb.buf[:wb.index-wb.baseSize], wb.buf[wb.baseSize:wb.index])
         wb.index -= wb.baseSize
+        wb.flushed -= wb.baseSize
     }
 }
-
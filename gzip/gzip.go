@@ -1,14 +1,12 @@
-package main
+package gzip
 
 import (
     "fmt"
     "os"
     "io"
-    "log"
     "encoding/binary"
     "time"
     "hash/crc32"
-    "compress/gzip"
     "errors"
     "github.com/goossaert/compression/gzip/deflate"
 )
@@ -25,12 +23,12 @@ const (
     GzipMagic2 = 0x8b
 )
 
-// Deflate constants
-const (
-    MaxBlockSizeNoCompress = 65535
+var (
+    ErrInvalidHeader = errors.New("Invalid gzip header")
+    ErrUnknownMethod = errors.New("Unknown compression method, expected 'deflate'")
+    ErrChecksum = errors.New("gzip CRC-32 or size does not match the data")
 )
 
-
 type GzipHeader struct {
     // Mandatory header fields
     magicHeader uint16
@@ -56,45 +54,88 @@ type GzipHeader struct {
 }
 
 
-func WriteGzipNoCompression(w io.Writer, data []byte) (err error) {
-    if len(data) > MaxBlockSizeNoCompress {
-        return errors.New(fmt.Sprintf("Doesn't support streams above %d bytes\n", MaxBlockSizeNoCompress))
+// ExtraField returns the extra field of the header, made of subfields, or
+// nil if there is none.
+func (h *GzipHeader) ExtraField() []byte {
+    return h.extraField
+}
+
+// Subfield returns the data of the subfield of the extra field with the IDs
+// 'si1' and 'si2', or nil if there is none.
+func (h *GzipHeader) Subfield(si1 byte, si2 byte) []byte {
+    extra := h.extraField
+    for len(extra) >= 4 {
+        length := int(binary.LittleEndian.Uint16(extra[2:4]))
+        if len(extra) < 4 + length {
+            break
+        }
+        if extra[0] == si1 && extra[1] == si2 {
+            return extra[4:4 + length]
+        }
+        extra = extra[4 + length:]
+    }
+    return nil
+}
+
+
+// extraFlags returns the XFL byte of the header for a compression level:
+// 2 for the slowest level, 4 for the fastest, as gzip does.
+func extraFlags(level int) byte {
+    switch level {
+    case deflate.BestCompression, deflate.Optimal:
+        return 2
+    case deflate.BestSpeed:
+        return 4
     }
+    return 0
+}
 
+
+// headerBytes returns the 10 bytes of a gzip header without optional
+// fields, for data compressed at 'level'.
+func headerBytes(level int) []byte {
     gzipHeader := make([]byte, 10)
     gzipHeader[0] = GzipMagic1
     gzipHeader[1] = GzipMagic2
     gzipHeader[2] = 8 // deflate
     gzipHeader[3] = 0 // flags
     binary.LittleEndian.PutUint32(gzipHeader[4:8], uint32(time.Now().Unix()))
-    gzipHeader[8] = 0 // leave extra flags empty
+    gzipHeader[8] = extraFlags(level)
     gzipHeader[9] = 255 // Operating System - 255 means Unknown
+    return gzipHeader
+}
 
-    // Deflate mode 0 header
-    deflateHeader := make([]byte, 5)
-    deflateHeader[0] = 0x01 // first three bits are 100, stored with least-significant bits first
-    binary.LittleEndian.PutUint16(deflateHeader[1:3], uint16(len(data)))
-    binary.LittleEndian.PutUint16(deflateHeader[3:5], uint16(^len(data)))
-
-    var checksum uint32 = 0
-    checksum = crc32.Update(checksum, crc32.IEEETable, data)
+// footerBytes returns the CRC-32 and the size modulo 2^32 of the data.
+func footerBytes(checksum uint32, size int64) []byte {
     gzipFooter := make([]byte, 8)
     binary.LittleEndian.PutUint32(gzipFooter[0:4], checksum)
-    binary.LittleEndian.PutUint32(gzipFooter[4:8], uint32(len(data)))
+    binary.LittleEndian.PutUint32(gzipFooter[4:8], uint32(size))
+    return gzipFooter
+}
+
+
+// WriteGzip writes 'data' as a gzip member compressed at 'level', one of the
+// levels of the deflate package.
+func WriteGzip(w io.Writer, data []byte, level int) (err error) {
+    dw, err := deflate.NewWriter(w, level)
+    if err != nil {
+        return err
+    }
 
-    if _, err = w.Write(gzipHeader); err != nil {
+    if _, err = w.Write(headerBytes(level)); err != nil {
         return err
     }
 
-    if _, err = w.Write(deflateHeader); err != nil {
+    if _, err = dw.Write(data); err != nil {
         return err
     }
 
-    if _, err = w.Write(data); err != nil {
+    if err = dw.Close(); err != nil {
         return err
     }
 
-    if _, err = w.Write(gzipFooter); err != nil {
+    checksum := crc32.ChecksumIEEE(data)
+    if _, err = w.Write(footerBytes(checksum, int64(len(data)))); err != nil {
         return err
     }
 
@@ -102,54 +143,53 @@ func WriteGzipNoCompression(w io.Writer, data []byte) (err error) {
 }
 
 
-func GzipReader(filepath string) error {
-    file, err := os.Open(filepath)
-    rb := deflate.NewReadBuffer(file, 4096)
+func WriteGzipNoCompression(w io.Writer, data []byte) (err error) {
+    return WriteGzip(w, data, deflate.NoCompression)
+}
 
-    if err = rb.LoadMoreBytes(); err != nil {
-        return err
+
+// readHeader reads the header of a gzip member and its optional fields.
+func readHeader(rb *deflate.ReadBuffer) (*GzipHeader, error) {
+    readBytes := func(n int) ([]byte, error) {
+        var out []byte
+        for len(out) < n {
+            temp, _, err := rb.ReadAlignedBytes(n - len(out))
+            if err != nil {
+                return nil, err
+            }
+            out = append(out, temp...)
+        }
+        return out, nil
     }
 
-    header, numBytesRead, err := rb.ReadAlignedBytes(10)
+    header, err := readBytes(10)
     if err != nil {
-        return err
-    }
-    if numBytesRead != 10 {
-        errors.New("Invalid file")
+        return nil, err
     }
 
-    gzipNumber1 := header[0]
-    gzipNumber2 := header[1]
-    compressionMethod := header[2]
-    flagText        := header[3] & 0x01
-    flagHeaderCRC   := header[3] & 0x02
-    flagExtraFields := header[3] & 0x04
-    flagName        := header[3] & 0x08
-    flagComment     := header[3] & 0x10
-
-    modificationTime := binary.LittleEndian.Uint32(header[4:8])
-
-    extraFlags := header[8]
-    operatingSystem := header[9]
+    h := new(GzipHeader)
+    h.magicHeader = binary.BigEndian.Uint16(header[0:2])
+    h.compressionMethod = header[2]
+    h.flags = header[3]
+    h.fileLastModifiedTimestamp = binary.LittleEndian.Uint32(header[4:8])
+    h.extraFlags = header[8]
+    h.operatingSystem = header[9]
 
-    if gzipNumber1 != GzipMagic1 || gzipNumber2 != GzipMagic2 {
-        errors.New("Invalid file")
+    if header[0] != GzipMagic1 || header[1] != GzipMagic2 {
+        return nil, ErrInvalidHeader
     }
-
-    fmt.Printf("Gzip magic numbers 0x%x 0x%x\n", gzipNumber1, gzipNumber2)
-
-    if compressionMethod != 8 {
-        errors.New("Unknown compression method, expected 'deflate'")
+    if h.compressionMethod != 8 {
+        return nil, ErrUnknownMethod
     }
 
-    if flagExtraFields == 1 {
-        temp, _, err := rb.ReadAlignedBytes(2)
+    if h.flags & ExtraFieldPresent != 0 {
+        temp, err := readBytes(2)
         if err != nil {
-            return err
+            return nil, err
         }
         lenExtra := binary.LittleEndian.Uint16(temp)
-        if _, _, err := rb.ReadAlignedBytes(int(lenExtra)); err != nil {
-            return err
+        if h.extraField, err = readBytes(int(lenExtra)); err != nil {
+            return nil, err
         }
     }
 
@@ -169,79 +209,152 @@ func GzipReader(filepath string) error {
     }
 
     // Read filename and comment if present
-    var filename, comment string
-    if flagName == 1 {
-        if err, filename = stringReader(rb); err != nil {
-            return err
+    if h.flags & OriginalFileNamePresent != 0 {
+        if err, h.originalFilename = stringReader(rb); err != nil {
+            return nil, err
         }
     }
-    if flagComment == 1 {
-        if err, comment = stringReader(rb); err != nil {
-            return err
+    if h.flags & FileCommentPresent != 0 {
+        if err, h.fileComment = stringReader(rb); err != nil {
+            return nil, err
         }
     }
 
-    if flagHeaderCRC == 1 {
+    if h.flags & HeaderCrc16Present != 0 {
         // Ignoring the Header CRC
-        _, _, err := rb.ReadAlignedBytes(2)
+        temp, err := readBytes(2)
         if err != nil {
-            return err
+            return nil, err
         }
+        h.headerCRC16 = binary.LittleEndian.Uint16(temp)
     }
 
-    // At this stage, the read buffer 'rb' is at the correct
-    // reading index to access the compressed data
+    return h, nil
+}
 
-    outfile, err := os.Create("./decompressed-data")
-    defer outfile.Close()
 
-    if err := deflate.DecodeStream(rb, outfile); err != nil {
-        return err
+// decompressMember decodes the gzip member at the current position of 'rb',
+// writes its data to 'writer', and checks its CRC-32 and size.
+func decompressMember(rb *deflate.ReadBuffer, writer io.Writer) (*GzipHeader, error) {
+    h, _, err := decodeMember(rb, writer, 0, nil)
+    return h, err
+}
+
+// decodeMember is decompressMember, and also appends to 'checkpoints' the
+// start of the DEFLATE stream and the checkpoints every 'span' bytes of its
+// data, if 'span' is more than zero. Their offsets are in the data of the
+// member.
+func decodeMember(rb *deflate.ReadBuffer, writer io.Writer, span int64, checkpoints []deflate.Checkpoint) (*GzipHeader, []deflate.Checkpoint, error) {
+    h, err := readHeader(rb)
+    if err != nil {
+        return nil, checkpoints, err
     }
 
-    fmt.Println("Modification time", time.Unix(int64(modificationTime), 0).Format(time.RFC822Z))
-    fmt.Printf("Filename: %s, Comment: %s\n", filename, comment)
+    // At this stage, the read buffer 'rb' is at the correct
+    // reading index to access the compressed data
 
-    if flagText == 1 && flagHeaderCRC == 1 && flagExtraFields == 1 && flagName == 1 && flagComment == 1 {
-        //
+    if span > 0 {
+        checkpoints = append(checkpoints, deflate.Checkpoint{BitOffset: rb.BitOffset()})
+    }
+    crc := crc32.NewIEEE()
+    counter := &countingWriter{writer: io.MultiWriter(writer, crc)}
+    if checkpoints, err = deflate.DecodeStreamCheckpoints(rb, counter, span, checkpoints); err != nil {
+        return nil, checkpoints, err
     }
 
-    fmt.Printf("Flags: text:%d, header:%d, extraFields:%d, name:%d, comment:%d\n", flagText, flagHeaderCRC, flagExtraFields, flagName, flagComment)
+    footer, err := readFooter(rb)
+    if err != nil {
+        return nil, checkpoints, err
+    }
+    h.checksum = binary.LittleEndian.Uint32(footer[0:4])
+    h.uncompressedInputSize = binary.LittleEndian.Uint32(footer[4:8])
+    if h.checksum != crc.Sum32() || h.uncompressedInputSize != uint32(counter.count) {
+        return nil, checkpoints, ErrChecksum
+    }
+    return h, checkpoints, nil
+}
 
-    if extraFlags == 1 && operatingSystem == 1 {
-        //
+// readFooter reads the CRC-32 and the size at the end of a member, after
+// its DEFLATE stream.
+func readFooter(rb *deflate.ReadBuffer) ([]byte, error) {
+    rb.AlignToByte()
+    footer := make([]byte, 0, 8)
+    for len(footer) < 8 {
+        temp, _, err := rb.ReadAlignedBytes(8 - len(footer))
+        if err != nil {
+            return nil, err
+        }
+        footer = append(footer, temp...)
     }
+    return footer, nil
+}
 
-    //b, _ := rb.ReadAlignedByte()
-    //fmt.Printf("byte %d\n", b)
+// decompressMembers decodes the gzip members from the current position of
+// 'rb' to the end of its reader, as their data put end to end, and returns
+// the header of the first one.
+func decompressMembers(rb *deflate.ReadBuffer, writer io.Writer) (*GzipHeader, error) {
+    var first *GzipHeader
+    for {
+        h, err := decompressMember(rb, writer)
+        if err != nil {
+            return nil, err
+        }
+        if first == nil {
+            first = h
+        }
+        if eof, err := rb.AtEOF(); err != nil {
+            return nil, err
+        } else if eof {
+            return first, nil
+        }
+    }
+}
 
-    fmt.Printf("out\n")
-    return nil
+// Decompress decodes the gzip members read from 'reader', and writes their
+// data to 'writer'.
+func Decompress(reader io.Reader, writer io.Writer) error {
+    _, err := decompressMembers(deflate.NewReadBuffer(reader, 4096), writer)
+    return err
+}
+
+type countingWriter struct {
+    writer io.Writer
+    count int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+    n, err := cw.writer.Write(p)
+    cw.count += int64(n)
+    return n, err
 }
 
 
-func main() {
-    data := "aaaaabcdefghijbbbbbbbbbbbbbbbbbbbbbaaaaabbb"
-    filepath := "./myfile-custom.gz"
-    file, err := os.OpenFile(filepath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+// GzipReader decompresses the gzip file at 'filepath' to
+// ./decompressed-data, and prints its header.
+func GzipReader(filepath string) error {
+    file, err := os.Open(filepath)
     if err != nil {
-       log.Fatal(err)
+        return err
     }
     defer file.Close()
 
-    err = WriteGzipNoCompression(file, []byte(data))
+    outfile, err := os.Create("./decompressed-data")
     if err != nil {
-        log.Fatal(err)
+        return err
     }
+    defer outfile.Close()
 
-    f, _ := os.Create("./myfile-stdlib.gz")
-    defer f.Close()
-    w, _ := gzip.NewWriterLevel(f, gzip.NoCompression)
-    //w := gzip.NewWriter(f)
-    w.Write([]byte(data))
-    w.Close()
-
-    if err := GzipReader("./myfile-stdlib.gz"); err != nil {
-        log.Fatal(err)
+    rb := deflate.NewReadBuffer(file, 4096)
+    h, err := decompressMembers(rb, outfile)
+    if err != nil {
+        return err
     }
+
+    fmt.Printf("Gzip magic numbers 0x%x 0x%x\n", h.magicHeader >> 8, h.magicHeader & 0xff)
+    fmt.Println("Modification time", time.Unix(int64(h.fileLastModifiedTimestamp), 0).Format(time.RFC822Z))
+    fmt.Printf("Filename: %s, Comment: %s\n", h.originalFilename, h.fileComment)
+    fmt.Printf("Flags: text:%d, header:%d, extraFields:%d, name:%d, comment:%d\n",
+               h.flags & FlagAscii, h.flags & HeaderCrc16Present >> 1, h.flags & ExtraFieldPresent >> 2,
+               h.flags & OriginalFileNamePresent >> 3, h.flags & FileCommentPresent >> 4)
+    return nil
 }
@@ -0,0 +1,35 @@
+package gzip
+
+import (
+    "bytes"
+    stdgzip "compress/gzip"
+    "io/ioutil"
+    "testing"
+
+    "github.com/goossaert/compression/gzip/deflate"
+)
+
+func TestWriteGzip(t *testing.T) {
+    data := bytes.Repeat([]byte("gzip member with some repeated text. "), 3000)
+    levels := map[int]byte{deflate.NoCompression: 0, deflate.BestSpeed: 4, deflate.DefaultCompression: 0, deflate.BestCompression: 2, deflate.Optimal: 2}
+    for level, xfl := range levels {
+        var buf bytes.Buffer
+        if err := WriteGzip(&buf, data, level); err != nil {
+            t.Fatal(err)
+        }
+        if buf.Bytes()[8] != xfl {
+            t.Errorf("Level %d: expected XFL %d, found %d", level, xfl, buf.Bytes()[8])
+        }
+        r, err := stdgzip.NewReader(&buf)
+        if err != nil {
+            t.Fatal(err)
+        }
+        out, err := ioutil.ReadAll(r)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !bytes.Equal(out, data) {
+            t.Errorf("Level %d: the data does not round trip", level)
+        }
+    }
+}
@@ -0,0 +1,182 @@
+package gzip
+
+import (
+    "bytes"
+    "errors"
+    "hash/crc32"
+    "io"
+    "runtime"
+    "sync"
+
+    "github.com/goossaert/compression/gzip/deflate"
+)
+
+const DefaultParallelBlockSize = 128 * 1024
+
+var ErrParallelWriterClosed = errors.New("gzip parallel writer is closed")
+
+// parallelJob is a chunk being compressed.
+type parallelJob struct {
+    out bytes.Buffer
+    crc uint32
+    size int
+    err error
+    done chan struct{}
+}
+
+// ParallelWriter writes one gzip member whose chunks are compressed by
+// several goroutines. Each chunk has the end of the chunk before it as
+// dictionary, and all but the last end with a sync flush, so that the
+// compressed chunks put end to end make one DEFLATE stream.
+type ParallelWriter struct {
+    writer io.Writer
+    level int
+    blockSize int
+    workers int
+    chunk []byte
+    dict []byte // end of the last chunk sent
+    jobs []*parallelJob // chunks sent but not written yet, in order
+    writers sync.Pool
+    wroteHeader bool
+    crc uint32
+    size int64
+    closed bool
+    err error
+}
+
+// NewParallelWriter returns a writer compressing chunks of 'blockSize' bytes
+// with 'workers' goroutines at most. A blockSize or workers of zero or less
+// means DefaultParallelBlockSize or one worker per CPU.
+func NewParallelWriter(w io.Writer, blockSize int, workers int) *ParallelWriter {
+    if blockSize <= 0 {
+        blockSize = DefaultParallelBlockSize
+    }
+    if workers <= 0 {
+        workers = runtime.NumCPU()
+    }
+    pw := new(ParallelWriter)
+    pw.writer = w
+    pw.level = deflate.DefaultCompression
+    pw.blockSize = blockSize
+    pw.workers = workers
+    pw.chunk = make([]byte, 0, blockSize)
+    return pw
+}
+
+func (pw *ParallelWriter) Write(p []byte) (int, error) {
+    if pw.closed {
+        return 0, ErrParallelWriterClosed
+    }
+    if pw.err != nil {
+        return 0, pw.err
+    }
+    n := len(p)
+    for len(p) > 0 {
+        size := pw.blockSize - len(pw.chunk)
+        if size > len(p) {
+            size = len(p)
+        }
+        pw.chunk = append(pw.chunk, p[:size]...)
+        p = p[size:]
+        if len(pw.chunk) == pw.blockSize {
+            pw.send(false)
+            if pw.err != nil {
+                return 0, pw.err
+            }
+        }
+    }
+    return n, nil
+}
+
+// Close compresses the last chunk, waits for all of them, and writes the
+// end of the member. It does not close the underlying writer.
+func (pw *ParallelWriter) Close() error {
+    if pw.closed {
+        return pw.err
+    }
+    pw.closed = true
+    if pw.err != nil {
+        return pw.err
+    }
+    pw.send(true)
+    for len(pw.jobs) > 0 && pw.err == nil {
+        pw.writeJob()
+    }
+    if pw.err == nil {
+        _, pw.err = pw.writer.Write(footerBytes(pw.crc, pw.size))
+    }
+    return pw.err
+}
+
+// send starts compressing the current chunk, after writing the oldest
+// chunks if 'workers' are busy.
+func (pw *ParallelWriter) send(final bool) {
+    for len(pw.jobs) >= pw.workers && pw.err == nil {
+        pw.writeJob()
+    }
+    if pw.err != nil {
+        return
+    }
+    chunk, dict := pw.chunk, pw.dict
+    job := &parallelJob{done: make(chan struct{})}
+    pw.jobs = append(pw.jobs, job)
+    go pw.compress(job, chunk, dict, final)
+
+    // The chunk is not written to anymore, so its end is the dictionary of
+    // the next one
+    if len(chunk) > deflate.WindowSize {
+        pw.dict = chunk[len(chunk) - deflate.WindowSize:]
+    } else {
+        pw.dict = chunk
+    }
+    if !final {
+        pw.chunk = make([]byte, 0, pw.blockSize)
+    }
+}
+
+func (pw *ParallelWriter) compress(job *parallelJob, chunk []byte, dict []byte, final bool) {
+    defer close(job.done)
+    var dw *deflate.Writer
+    if v := pw.writers.Get() ; v != nil {
+        dw = v.(*deflate.Writer)
+        dw.ResetDict(&job.out, dict)
+    } else {
+        dw, job.err = deflate.NewWriterDict(&job.out, pw.level, dict)
+        if job.err != nil {
+            return
+        }
+    }
+    if _, job.err = dw.Write(chunk) ; job.err != nil {
+        return
+    }
+    if final {
+        job.err = dw.Close()
+    } else {
+        job.err = dw.Flush()
+    }
+    job.crc = crc32.ChecksumIEEE(chunk)
+    job.size = len(chunk)
+    pw.writers.Put(dw)
+}
+
+// writeJob waits for the oldest chunk, and writes it.
+func (pw *ParallelWriter) writeJob() {
+    job := pw.jobs[0]
+    pw.jobs = pw.jobs[1:]
+    <-job.done
+    if job.err != nil {
+        pw.err = job.err
+        return
+    }
+    if !pw.wroteHeader {
+        if _, pw.err = pw.writer.Write(headerBytes(pw.level)) ; pw.err != nil {
+            return
+        }
+        pw.wroteHeader = true
+    }
+    if _, pw.err = pw.writer.Write(job.out.Bytes()) ; pw.err != nil {
+        return
+    }
+    pw.crc = crc32Combine(pw.crc, job.crc, int64(job.size))
+    pw.size += int64(job.size)
+}
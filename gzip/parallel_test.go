@@ -0,0 +1,85 @@
+package gzip
+
+import (
+    "bytes"
+    stdgzip "compress/gzip"
+    "fmt"
+    "io/ioutil"
+    "testing"
+)
+
+// parallelData returns text that repeats across chunks, so chunks compress
+// better with the dictionary of the chunk before them.
+func parallelData(size int) []byte {
+    var buf bytes.Buffer
+    for i := 0 ; buf.Len() < size ; i++ {
+        fmt.Fprintf(&buf, "line %d of the nightly dump, with field %d\n", i, i % 97)
+    }
+    return buf.Bytes()[:size]
+}
+
+func TestParallelWriter(t *testing.T) {
+    sizes := []int{0, 1, 1000, 65536, 300000}
+    for _, size := range sizes {
+        data := parallelData(size)
+        var buf bytes.Buffer
+        w := NewParallelWriter(&buf, 65536, 4)
+        // Odd writes, which do not end on chunk boundaries
+        for i := 0 ; i < len(data) ; i += 10007 {
+            end := i + 10007
+            if end > len(data) {
+                end = len(data)
+            }
+            if _, err := w.Write(data[i:end]) ; err != nil {
+                t.Fatal(err)
+            }
+        }
+        if err := w.Close() ; err != nil {
+            t.Fatal(err)
+        }
+        compressed := buf.Bytes()
+
+        r, err := stdgzip.NewReader(bytes.NewReader(compressed))
+        if err != nil {
+            t.Fatal(err)
+        }
+        out, err := ioutil.ReadAll(r)
+        if err != nil {
+            t.Fatalf("Size %d: %v", size, err)
+        }
+        if !bytes.Equal(out, data) {
+            t.Errorf("Size %d: the data does not round trip through compress/gzip", size)
+        }
+
+        var decompressed bytes.Buffer
+        if err := Decompress(bytes.NewReader(compressed), &decompressed) ; err != nil {
+            t.Fatalf("Size %d: %v", size, err)
+        }
+        if !bytes.Equal(decompressed.Bytes(), data) {
+            t.Errorf("Size %d: the data does not round trip through Decompress", size)
+        }
+    }
+}
+
+func TestParallelWriterRatio(t *testing.T) {
+    data := parallelData(1 << 20)
+    var serial, parallel bytes.Buffer
+    WriteGzip(&serial, data, -1)
+    w := NewParallelWriter(&parallel, 0, 0)
+    w.Write(data)
+    w.Close()
+    // The dictionaries keep the ratio close to the one of a single stream
+    if parallel.Len() > serial.Len() + serial.Len() / 50 {
+        t.Errorf("Parallel output is %d bytes, serial is %d", parallel.Len(), serial.Len())
+    }
+}
+
+func TestDecompressChecksum(t *testing.T) {
+    var buf bytes.Buffer
+    WriteGzip(&buf, parallelData(5000), 6)
+    compressed := buf.Bytes()
+    compressed[len(compressed) - 8] ^= 1
+    if err := Decompress(bytes.NewReader(compressed), ioutil.Discard) ; err != ErrChecksum {
+        t.Errorf("Expected ErrChecksum, found %v", err)
+    }
+}
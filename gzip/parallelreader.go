@@ -0,0 +1,307 @@
+package gzip
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "io"
+    "runtime"
+    "sync"
+
+    "github.com/goossaert/compression/gzip/deflate"
+)
+
+const parallelReadSize = 1 << 20
+
+// maxParallelPending is the most input held to find the end of a member.
+const maxParallelPending = 4 << 20
+
+var ErrParallelReaderClosed = errors.New("gzip parallel reader is closed")
+
+// memberJob is a piece of the input holding one member or more, being
+// decoded. A partial piece is the part of a member too large to hold, and is
+// not decoded on its own.
+type memberJob struct {
+    data []byte
+    partial bool
+    out bytes.Buffer
+    stream *io.PipeReader // the data, when decoded as it is read
+    err error
+    done chan struct{}
+}
+
+func (job *memberJob) decode() {
+    defer close(job.done)
+    rb := deflate.NewReadBuffer(bytes.NewReader(job.data), 65536)
+    _, job.err = decompressMembers(rb, &job.out)
+}
+
+// ParallelReader decodes the members of gzip data with several goroutines,
+// and returns their data in order. Members are found without decoding them,
+// from the 'BC' subfield of BGZF headers, or else at the next gzip header.
+// A member cut too early, or larger than maxParallelPending, is decoded in a
+// single goroutine as it is read, along with the pieces after it until one
+// ends with a member.
+type ParallelReader struct {
+    jobs chan *memberJob // jobs in the order of the input, closed after the last one
+    current *memberJob
+    quit chan struct{}
+    closeOnce sync.Once
+    err error
+}
+
+// NewParallelReader returns a reader of the gzip data of 'r', decoding
+// 'workers' members at most at the same time, or one per CPU if workers is
+// zero or less.
+func NewParallelReader(r io.Reader, workers int) *ParallelReader {
+    if workers <= 0 {
+        workers = runtime.NumCPU()
+    }
+    pr := new(ParallelReader)
+    pr.jobs = make(chan *memberJob, workers)
+    pr.quit = make(chan struct{})
+    go pr.split(r, workers)
+    return pr
+}
+
+func (pr *ParallelReader) Read(p []byte) (int, error) {
+    for {
+        if pr.current != nil && pr.current.stream != nil {
+            n, err := pr.current.stream.Read(p)
+            if err != nil {
+                pr.current = nil
+                if err != io.EOF {
+                    pr.err = err
+                }
+            }
+            if n > 0 {
+                return n, nil
+            }
+            continue
+        }
+        if pr.current != nil && pr.current.out.Len() > 0 {
+            return pr.current.out.Read(p)
+        }
+        if pr.err != nil {
+            return 0, pr.err
+        }
+        job, ok := <-pr.jobs
+        if !ok {
+            pr.err = io.EOF
+            continue
+        }
+        <-job.done
+        // The piece was cut where the data looked like a header, or is part
+        // of a large member
+        if job.partial || job.err == io.ErrUnexpectedEOF {
+            job = pr.stream(job)
+        }
+        pr.current = job
+        pr.err = job.err
+    }
+}
+
+// stream decodes the data of 'job', and of the pieces after it until a
+// member ends with one of them, as it is read.
+func (pr *ParallelReader) stream(job *memberJob) *memberJob {
+    pipeReader, pipeWriter := io.Pipe()
+    jr := &jobReader{data: job.data, jobs: pr.jobs}
+    go func() {
+        rb := deflate.NewReadBuffer(jr, 65536)
+        for {
+            if _, err := decompressMember(rb, pipeWriter); err != nil {
+                pipeWriter.CloseWithError(err)
+                return
+            }
+            if rb.BitsLeftToRead() == 0 && len(jr.data) == 0 {
+                pipeWriter.Close()
+                return
+            }
+        }
+    }()
+    return &memberJob{stream: pipeReader}
+}
+
+// jobReader reads the data of a piece, then of the pieces after it.
+type jobReader struct {
+    data []byte
+    jobs chan *memberJob
+}
+
+func (jr *jobReader) Read(p []byte) (int, error) {
+    for len(jr.data) == 0 {
+        job, ok := <-jr.jobs
+        if !ok {
+            return 0, io.EOF
+        }
+        if job.data == nil {
+            <-job.done
+            return 0, job.err
+        }
+        jr.data = job.data
+    }
+    n := copy(p, jr.data)
+    jr.data = jr.data[n:]
+    return n, nil
+}
+
+// Close stops decoding. It does not close the underlying reader.
+func (pr *ParallelReader) Close() error {
+    pr.closeOnce.Do(func() {
+        close(pr.quit)
+    })
+    if pr.current != nil && pr.current.stream != nil {
+        pr.current.stream.CloseWithError(ErrParallelReaderClosed)
+    }
+    if pr.err == nil || pr.err == io.EOF {
+        pr.err = ErrParallelReaderClosed
+        return nil
+    }
+    return pr.err
+}
+
+// split cuts the input into members, and starts decoding them.
+func (pr *ParallelReader) split(r io.Reader, workers int) {
+    defer close(pr.jobs)
+    sem := make(chan struct{}, workers)
+    send := func(job *memberJob) bool {
+        select {
+        case pr.jobs <- job:
+            return true
+        case <-pr.quit:
+            return false
+        }
+    }
+
+    var pending []byte
+    from := 0 // where to look for the next header in 'pending'
+    eof := false
+    partial := false // 'pending' starts inside a member too large to hold
+    for len(pending) > 0 || !eof {
+        size, piece := 0, partial
+        if partial {
+            var start int
+            start, from = nextHeader(pending, from)
+            if start >= 0 || eof {
+                partial = false
+                size = start
+                if start < 0 {
+                    size = len(pending)
+                } else if start == 0 {
+                    continue
+                }
+            }
+        } else if len(pending) > 0 {
+            size, from = memberSize(pending, from, eof)
+        }
+        if size == 0 && len(pending) >= maxParallelPending {
+            // The member is sent in pieces, but for the last bytes which
+            // may start the next header
+            size, piece, partial = len(pending) - 3, true, true
+        }
+        if size == 0 {
+            if eof {
+                break
+            }
+            // More data is needed to find the end of the member
+            n := len(pending)
+            pending = append(pending, make([]byte, parallelReadSize)...)
+            read, err := io.ReadFull(r, pending[n:])
+            pending = pending[:n + read]
+            if err == io.EOF || err == io.ErrUnexpectedEOF {
+                eof = true
+            } else if err != nil {
+                job := &memberJob{err: err, done: make(chan struct{})}
+                close(job.done)
+                send(job)
+                return
+            }
+            continue
+        }
+
+        job := &memberJob{data: append([]byte(nil), pending[:size]...), partial: piece, done: make(chan struct{})}
+        pending = pending[:copy(pending, pending[size:])]
+        from = 0
+        if piece {
+            close(job.done)
+            if !send(job) {
+                return
+            }
+            continue
+        }
+        select {
+        case sem <- struct{}{}:
+        case <-pr.quit:
+            return
+        }
+        go func() {
+            job.decode()
+            <-sem
+        }()
+        if !send(job) {
+            return
+        }
+    }
+}
+
+// memberSize returns the size of the member at the start of 'buf', or 0 if
+// more data is needed to know it, with where to look next for the header
+// after it. Without a BGZF block size, the member ends where the next header
+// starts, or at the end of the input if 'eof'.
+func memberSize(buf []byte, from int, eof bool) (int, int) {
+    rb := deflate.NewReadBuffer(bytes.NewReader(buf), 4096)
+    h, err := readHeader(rb)
+    if err == io.ErrUnexpectedEOF && !eof {
+        return 0, from
+    }
+    if err != nil {
+        // Decoding the whole input reports the error
+        return len(buf), 0
+    }
+    if bsize := h.Subfield('B', 'C') ; len(bsize) == 2 {
+        size := int(binary.LittleEndian.Uint16(bsize)) + 1
+        if size > len(buf) {
+            if eof {
+                return len(buf), 0
+            }
+            return 0, from
+        }
+        return size, 0
+    }
+
+    // The shortest DEFLATE stream is 2 bytes, followed by the 8 bytes of
+    // the footer
+    start := int(rb.BitOffset() / 8) + 10
+    if from < start {
+        from = start
+    }
+    next, from := nextHeader(buf, from)
+    if next >= 0 {
+        return next, 0
+    }
+    if eof {
+        return len(buf), 0
+    }
+    return 0, from
+}
+
+// nextHeader returns where the first gzip header from 'from' in 'buf'
+// starts, or -1 with where to look again after more data is read.
+func nextHeader(buf []byte, from int) (int, int) {
+    for from + 4 <= len(buf) {
+        i := bytes.Index(buf[from:], []byte{GzipMagic1, GzipMagic2, 8})
+        if i < 0 || from + i + 4 > len(buf) {
+            break
+        }
+        from += i
+        if buf[from + 3] & 0xe0 == 0 {
+            return from, 0
+        }
+        from += 1
+    }
+    // The last 3 bytes may start a header
+    if from < len(buf) - 3 {
+        from = len(buf) - 3
+    }
+    return -1, from
+}
@@ -0,0 +1,104 @@
+package gzip
+
+import (
+    "bytes"
+    "encoding/binary"
+    "io/ioutil"
+    "math/rand"
+    "testing"
+    "testing/iotest"
+
+    "github.com/goossaert/compression/gzip/deflate"
+)
+
+// members returns 'data' as gzip members of 'size' bytes of data each.
+func members(t *testing.T, data []byte, size int, level int) []byte {
+    var buf bytes.Buffer
+    for i := 0 ; i < len(data) ; i += size {
+        end := i + size
+        if end > len(data) {
+            end = len(data)
+        }
+        if err := WriteGzip(&buf, data[i:end], level) ; err != nil {
+            t.Fatal(err)
+        }
+    }
+    return buf.Bytes()
+}
+
+// withBlockSize adds to each member a 'BC' subfield with its size, as BGZF
+// does.
+func withBlockSize(t *testing.T, data []byte, size int) []byte {
+    var out []byte
+    for i := 0 ; i < len(data) ; i += size {
+        end := i + size
+        if end > len(data) {
+            end = len(data)
+        }
+        var member bytes.Buffer
+        WriteGzip(&member, data[i:end], 6)
+        m := member.Bytes()
+        extra := []byte{6, 0, 'B', 'C', 2, 0, 0, 0}
+        binary.LittleEndian.PutUint16(extra[6:], uint16(len(m) + len(extra) - 1))
+        m[3] |= ExtraFieldPresent
+        out = append(out, m[:10]...)
+        out = append(out, extra...)
+        out = append(out, m[10:]...)
+    }
+    return out
+}
+
+func TestParallelReader(t *testing.T) {
+    data := parallelData(500000)
+    // Stored members hold the bytes of a header, which do not start members
+    fake := append([]byte{GzipMagic1, GzipMagic2, 8, 0}, parallelData(100000)...)
+    fake = bytes.Repeat(fake, 3)
+    // A member larger than maxParallelPending, with a header in its data
+    // past the limit
+    large := make([]byte, 6 << 20)
+    rand.New(rand.NewSource(1)).Read(large)
+    copy(large[9 << 19:], []byte{GzipMagic1, GzipMagic2, 8, 0})
+    inputs := map[string][]byte{
+        "large member": append(members(t, large, len(large), deflate.NoCompression), members(t, data, 30000, 6)...),
+        "members": members(t, data, 30000, 6),
+        "one member": members(t, data, len(data), 6),
+        "headers in data": members(t, fake, 70000, deflate.NoCompression),
+        "block sizes": withBlockSize(t, data, 40000),
+    }
+    expected := map[string][]byte{"large member": append(large, data...), "members": data, "one member": data, "headers in data": fake, "block sizes": data}
+    for name, input := range inputs {
+        r := NewParallelReader(iotest.HalfReader(bytes.NewReader(input)), 3)
+        out, err := ioutil.ReadAll(r)
+        if err != nil {
+            t.Fatalf("%s: %v", name, err)
+        }
+        if !bytes.Equal(out, expected[name]) {
+            t.Errorf("%s: the data does not round trip", name)
+        }
+        r.Close()
+
+        var decompressed bytes.Buffer
+        if err := Decompress(bytes.NewReader(input), &decompressed) ; err != nil {
+            t.Fatalf("%s: %v", name, err)
+        }
+        if !bytes.Equal(decompressed.Bytes(), expected[name]) {
+            t.Errorf("%s: the data does not round trip through Decompress", name)
+        }
+    }
+}
+
+func TestParallelReaderInvalid(t *testing.T) {
+    input := members(t, parallelData(100000), 10000, 6)
+    input[len(input) / 2] ^= 0x55
+    r := NewParallelReader(bytes.NewReader(input), 2)
+    if _, err := ioutil.ReadAll(r) ; err == nil {
+        t.Errorf("Expected an error for corrupted data")
+    }
+    r.Close()
+
+    r = NewParallelReader(bytes.NewReader(input[:len(input) - 3]), 2)
+    if _, err := ioutil.ReadAll(r) ; err == nil {
+        t.Errorf("Expected an error for truncated data")
+    }
+    r.Close()
+}
@@ -0,0 +1,299 @@
+package gzip
+
+import (
+    "encoding/binary"
+    "errors"
+    "io"
+    "io/ioutil"
+    "math"
+    "sort"
+    "sync"
+
+    "github.com/goossaert/compression/gzip/deflate"
+)
+
+const DefaultSeekSpan = 1 << 20
+
+var (
+    ErrInvalidSeekIndex = errors.New("Invalid gzip seek index")
+    ErrInvalidWhence = errors.New("Invalid whence for Seek")
+    ErrNegativeOffset = errors.New("Negative offset in gzip data")
+)
+
+var seekIndexMagic = []byte("GZSI")
+
+// SeekIndex holds the checkpoints of gzip data, by increasing offsets, as
+// zran records them: a block boundary about every Span bytes of data, with
+// the 32 KiB of data before it, from which the data can be decoded.
+type SeekIndex struct {
+    Span int64
+    Size int64 // bytes of data
+    Checkpoints []deflate.Checkpoint
+}
+
+// BuildSeekIndex decodes the gzip data of 'r', and records a checkpoint
+// every 'span' bytes of data, or every DefaultSeekSpan if span is zero or
+// less.
+func BuildSeekIndex(r io.Reader, span int64) (*SeekIndex, error) {
+    if span <= 0 {
+        span = DefaultSeekSpan
+    }
+    idx := &SeekIndex{Span: span}
+    rb := deflate.NewReadBuffer(r, 65536)
+    counter := &countingWriter{writer: ioutil.Discard}
+    var checkpoints []deflate.Checkpoint
+    for {
+        base := counter.count
+        _, found, err := decodeMember(rb, counter, span, checkpoints[:0])
+        if err != nil {
+            return nil, err
+        }
+        checkpoints = found
+        // The start of a member is only kept 'span' bytes after the last
+        // checkpoint
+        last := len(idx.Checkpoints) - 1
+        if last >= 0 && base - idx.Checkpoints[last].Offset < span {
+            found = found[1:]
+        }
+        for _, c := range found {
+            c.Offset += base
+            idx.Checkpoints = append(idx.Checkpoints, c)
+        }
+        if eof, err := rb.AtEOF(); err != nil {
+            return nil, err
+        } else if eof {
+            break
+        }
+    }
+    idx.Size = counter.count
+    return idx, nil
+}
+
+// WriteTo writes the index: "GZSI", the span, the size, the number of
+// checkpoints as 64-bit little-endian numbers, then for each checkpoint its
+// bit offset and offset as 64-bit numbers, and its window, after its size as
+// a 32-bit number.
+func (idx *SeekIndex) WriteTo(w io.Writer) (int64, error) {
+    buf := append([]byte(nil), seekIndexMagic...)
+    for _, v := range []int64{idx.Span, idx.Size, int64(len(idx.Checkpoints))} {
+        buf = appendUint64(buf, uint64(v))
+    }
+    for _, c := range idx.Checkpoints {
+        buf = appendUint64(buf, uint64(c.BitOffset))
+        buf = appendUint64(buf, uint64(c.Offset))
+        buf = append(buf, 0, 0, 0, 0)
+        binary.LittleEndian.PutUint32(buf[len(buf) - 4:], uint32(len(c.Window)))
+        buf = append(buf, c.Window...)
+    }
+    n, err := w.Write(buf)
+    return int64(n), err
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+    var temp [8]byte
+    binary.LittleEndian.PutUint64(temp[:], v)
+    return append(buf, temp[:]...)
+}
+
+// ReadSeekIndex reads an index written by SeekIndex.WriteTo.
+func ReadSeekIndex(r io.Reader) (*SeekIndex, error) {
+    magic := make([]byte, len(seekIndexMagic))
+    if _, err := io.ReadFull(r, magic); err != nil {
+        return nil, err
+    }
+    if string(magic) != string(seekIndexMagic) {
+        return nil, ErrInvalidSeekIndex
+    }
+    var header [3]int64
+    if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+        return nil, noEOF(err)
+    }
+    if header[2] < 0 {
+        return nil, ErrInvalidSeekIndex
+    }
+    idx := &SeekIndex{Span: header[0], Size: header[1]}
+    for i := int64(0) ; i < header[2] ; i++ {
+        var fields struct {
+            BitOffset int64
+            Offset int64
+            WindowSize uint32
+        }
+        if err := binary.Read(r, binary.LittleEndian, &fields); err != nil {
+            return nil, noEOF(err)
+        }
+        if fields.WindowSize > deflate.WindowSize {
+            return nil, ErrInvalidSeekIndex
+        }
+        c := deflate.Checkpoint{BitOffset: fields.BitOffset, Offset: fields.Offset, Window: make([]byte, fields.WindowSize)}
+        if _, err := io.ReadFull(r, c.Window); err != nil {
+            return nil, noEOF(err)
+        }
+        idx.Checkpoints = append(idx.Checkpoints, c)
+    }
+    return idx, nil
+}
+
+
+// IndexedReader reads the data of a gzip file at any offset, with its seek
+// index. Sequential reads continue the decoding where the previous one
+// stopped: only Seek and reads at other offsets decode again from a
+// checkpoint.
+type IndexedReader struct {
+    file io.ReaderAt
+    index *SeekIndex
+    pos int64
+
+    mu sync.Mutex
+    pipe *io.PipeReader // data being decoded from 'next', nil if none
+    next int64
+}
+
+func NewIndexedReader(file io.ReaderAt, index *SeekIndex) *IndexedReader {
+    return &IndexedReader{file: file, index: index}
+}
+
+// Size returns the number of bytes of data.
+func (ir *IndexedReader) Size() int64 {
+    return ir.index.Size
+}
+
+func (ir *IndexedReader) ReadAt(p []byte, off int64) (int, error) {
+    if off < 0 {
+        return 0, ErrNegativeOffset
+    }
+    if off >= ir.index.Size {
+        return 0, io.EOF
+    }
+    ir.mu.Lock()
+    defer ir.mu.Unlock()
+    if ir.pipe == nil || ir.next != off {
+        if err := ir.start(off); err != nil {
+            return 0, err
+        }
+    }
+    n, err := io.ReadFull(ir.pipe, p)
+    ir.next += int64(n)
+    if err != nil {
+        ir.stop()
+    }
+    // The data only ends at the size of the index: an earlier end means the
+    // file is truncated
+    if err == io.EOF || err == io.ErrUnexpectedEOF {
+        if ir.next == ir.index.Size {
+            err = io.EOF
+        } else {
+            err = io.ErrUnexpectedEOF
+        }
+    }
+    return n, err
+}
+
+func (ir *IndexedReader) Read(p []byte) (int, error) {
+    n, err := ir.ReadAt(p, ir.pos)
+    ir.pos += int64(n)
+    if err == io.EOF && n > 0 {
+        err = nil
+    }
+    return n, err
+}
+
+func (ir *IndexedReader) Seek(offset int64, whence int) (int64, error) {
+    switch whence {
+    case io.SeekStart:
+    case io.SeekCurrent:
+        offset += ir.pos
+    case io.SeekEnd:
+        offset += ir.index.Size
+    default:
+        return 0, ErrInvalidWhence
+    }
+    if offset < 0 {
+        return 0, ErrNegativeOffset
+    }
+    ir.pos = offset
+    return offset, nil
+}
+
+// Close stops the decoding in progress. It does not close the file.
+func (ir *IndexedReader) Close() error {
+    ir.mu.Lock()
+    defer ir.mu.Unlock()
+    ir.stop()
+    return nil
+}
+
+// start stops the decoding in progress, and decodes from the checkpoint
+// before 'off' in a goroutine, skipping the data before 'off'.
+func (ir *IndexedReader) start(off int64) error {
+    ir.stop()
+    checkpoints := ir.index.Checkpoints
+    i := sort.Search(len(checkpoints), func(i int) bool {
+        return checkpoints[i].Offset > off
+    }) - 1
+    if i < 0 {
+        return ErrInvalidSeekIndex
+    }
+    c := checkpoints[i]
+    pr, pw := io.Pipe()
+    go func() {
+        pw.CloseWithError(decodeFrom(ir.file, c, &skipWriter{skip: off - c.Offset, writer: pw}))
+    }()
+    ir.pipe = pr
+    ir.next = off
+    return nil
+}
+
+// stop makes the goroutine decoding into the pipe return, if there is one.
+func (ir *IndexedReader) stop() {
+    if ir.pipe != nil {
+        ir.pipe.Close()
+        ir.pipe = nil
+    }
+}
+
+// decodeFrom decodes the data of 'file' from the checkpoint 'c' to the end
+// of the last member, and writes it to 'writer'. The CRC-32 of the members
+// are not checked, as their data is only decoded from 'c'.
+func decodeFrom(file io.ReaderAt, c deflate.Checkpoint, writer io.Writer) error {
+    start := c.BitOffset / 8
+    rb := deflate.NewReadBuffer(io.NewSectionReader(file, start, math.MaxInt64 - start), 65536)
+    if _, err := rb.ReadBits(uint(c.BitOffset % 8)); err != nil {
+        return err
+    }
+    err := deflate.DecodeStreamDict(rb, writer, c.Window)
+    for err == nil {
+        if _, err = readFooter(rb); err != nil {
+            break
+        }
+        var eof bool
+        if eof, err = rb.AtEOF(); err != nil || eof {
+            break
+        }
+        if _, err = readHeader(rb); err != nil {
+            break
+        }
+        err = deflate.DecodeStream(rb, writer)
+    }
+    return err
+}
+
+// skipWriter skips the first 'skip' bytes written, and writes the others
+// to 'writer'.
+type skipWriter struct {
+    skip int64
+    writer io.Writer
+}
+
+func (sw *skipWriter) Write(b []byte) (int, error) {
+    length := len(b)
+    if sw.skip >= int64(len(b)) {
+        sw.skip -= int64(len(b))
+        return length, nil
+    }
+    b = b[sw.skip:]
+    sw.skip = 0
+    if _, err := sw.writer.Write(b); err != nil {
+        return 0, err
+    }
+    return length, nil
+}
@@ -0,0 +1,135 @@
+package gzip
+
+import (
+    "bytes"
+    stdgzip "compress/gzip"
+    "io"
+    "io/ioutil"
+    "math/rand"
+    "testing"
+)
+
+func TestSeekIndex(t *testing.T) {
+    data := parallelData(2000000)
+    random := make([]byte, 200000)
+    rand.New(rand.NewSource(1)).Read(random)
+    data = append(data[:1000000], append(random, data[1000000:]...)...)
+
+    var stdlib bytes.Buffer
+    w, _ := stdgzip.NewWriterLevel(&stdlib, 6)
+    w.Write(data)
+    w.Close()
+    inputs := map[string][]byte{
+        "stdlib": stdlib.Bytes(),
+        "members": members(t, data, 300000, 6),
+        "stored": members(t, data, len(data), 0),
+    }
+
+    rng := rand.New(rand.NewSource(2))
+    for name, input := range inputs {
+        index, err := BuildSeekIndex(bytes.NewReader(input), 100000)
+        if err != nil {
+            t.Fatalf("%s: %v", name, err)
+        }
+        if index.Size != int64(len(data)) {
+            t.Errorf("%s: expected size %d, found %d", name, len(data), index.Size)
+        }
+        if len(index.Checkpoints) < 10 {
+            t.Errorf("%s: only %d checkpoints", name, len(index.Checkpoints))
+        }
+
+        // The index reads back the same
+        var buf bytes.Buffer
+        index.WriteTo(&buf)
+        index, err = ReadSeekIndex(&buf)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        r := NewIndexedReader(bytes.NewReader(input), index)
+        p := make([]byte, 5000)
+        for i := 0 ; i < 30 ; i++ {
+            off := rng.Int63n(int64(len(data)))
+            n, err := r.ReadAt(p, off)
+            if err != nil && err != io.EOF {
+                t.Fatalf("%s: %v", name, err)
+            }
+            if !bytes.Equal(p[:n], data[off:off + int64(n)]) || (n < len(p) && off + int64(n) != int64(len(data))) {
+                t.Errorf("%s: wrong data at %d", name, off)
+            }
+        }
+
+        r.Seek(-70000, io.SeekEnd)
+        tail, err := ioutil.ReadAll(r)
+        if err != nil || !bytes.Equal(tail, data[len(data) - 70000:]) {
+            t.Errorf("%s: wrong data at the end: %v", name, err)
+        }
+    }
+}
+
+// countingReaderAt counts the bytes read from a file.
+type countingReaderAt struct {
+    file io.ReaderAt
+    count int64
+}
+
+func (cr *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+    n, err := cr.file.ReadAt(p, off)
+    cr.count += int64(n)
+    return n, err
+}
+
+func TestIndexedReaderSequential(t *testing.T) {
+    data := parallelData(4000000)
+    input := members(t, data, len(data), 6)
+    index, err := BuildSeekIndex(bytes.NewReader(input), 100000)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Small reads, as io.Copy does through a section, decode the file once
+    file := &countingReaderAt{file: bytes.NewReader(input)}
+    r := NewIndexedReader(file, index)
+    defer r.Close()
+    var out bytes.Buffer
+    if _, err := io.CopyBuffer(&out, io.NewSectionReader(r, 1000, int64(len(data))), make([]byte, 32768)); err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(out.Bytes(), data[1000:]) {
+        t.Errorf("Wrong data")
+    }
+    if file.count > 2 * int64(len(input)) {
+        t.Errorf("%d bytes read from a file of %d bytes", file.count, len(input))
+    }
+
+    // Reads elsewhere start again from a checkpoint
+    p := make([]byte, 1000)
+    for _, off := range []int64{3000000, 500, 501000, int64(len(data)) - 10} {
+        n, err := r.ReadAt(p, off)
+        if err != nil && err != io.EOF {
+            t.Fatal(err)
+        }
+        if !bytes.Equal(p[:n], data[off:off + int64(n)]) {
+            t.Errorf("Wrong data at %d", off)
+        }
+    }
+}
+
+func TestIndexedReaderTruncated(t *testing.T) {
+    data := parallelData(1000000)
+    input := members(t, data, len(data), 6)
+    index, err := BuildSeekIndex(bytes.NewReader(input), 100000)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    r := NewIndexedReader(bytes.NewReader(input[:len(input) / 2]), index)
+    defer r.Close()
+    if _, err := ioutil.ReadAll(r); err == nil || err == io.EOF {
+        t.Errorf("Expected an error on a truncated file, found %v", err)
+    }
+    p := make([]byte, 1000)
+    if _, err := r.ReadAt(p, int64(len(data)) - 500); err == nil || err == io.EOF {
+        t.Errorf("Expected an error at the end of a truncated file, found %v", err)
+    }
+}
@@ -0,0 +1,299 @@
+package huffman
+
+import (
+    "io"
+
+    "github.com/goossaert/compression/logging"
+    "github.com/dgryski/go-bitstream"
+)
+
+// Adaptive Huffman coding with Vitter's algorithm (Algorithm V, 1987).
+//
+// Encoder and decoder start from the same tree, holding only the NYT node
+// ("not yet transmitted"), and both update it after every symbol, so no
+// frequency table is ever stored. A symbol seen for the first time is sent as
+// the code of the NYT node followed by the symbol in 9 raw bits. The stream
+// ends with the pseudo-symbol AdaptiveEOF, which makes it self-terminating.
+
+const (
+    AdaptiveEOF = 256
+    adaptiveNumSymbols = 257
+    adaptiveSymbolBits = 9
+    adaptiveNumNodes = 2 * (adaptiveNumSymbols + 1) - 1
+    adaptiveRoot = adaptiveNumNodes - 1
+)
+
+
+type anode struct {
+    parent *anode
+    left *anode
+    right *anode
+    weight uint64
+    symbol int
+    number int // implicit numbering, the root has the highest number
+}
+
+func (node *anode) isLeaf() bool {
+    return node.left == nil
+}
+
+
+type adaptiveTree struct {
+    nodes [adaptiveNumNodes]*anode
+    leaves [adaptiveNumSymbols]*anode
+    nyt *anode
+}
+
+func newAdaptiveTree() *adaptiveTree {
+    at := new(adaptiveTree)
+    at.nyt = &anode{symbol: -1, number: adaptiveRoot}
+    at.nodes[adaptiveRoot] = at.nyt
+    return at
+}
+
+func (at *adaptiveTree) root() *anode {
+    return at.nodes[adaptiveRoot]
+}
+
+// swap exchanges the positions of two nodes in the tree, along with their
+// implicit numbers. Neither node can be an ancestor of the other.
+func (at *adaptiveTree) swap(a, b *anode) {
+    if a.parent == b.parent {
+        a.parent.left, a.parent.right = a.parent.right, a.parent.left
+    } else {
+        if a.parent.left == a {
+            a.parent.left = b
+        } else {
+            a.parent.right = b
+        }
+        if b.parent.left == b {
+            b.parent.left = a
+        } else {
+            b.parent.right = a
+        }
+        a.parent, b.parent = b.parent, a.parent
+    }
+    at.nodes[a.number], at.nodes[b.number] = b, a
+    a.number, b.number = b.number, a.number
+}
+
+// leader returns the highest-numbered node of the block of 'node', a block
+// being all the leaves, or all the internal nodes, of a given weight.
+func (at *adaptiveTree) leader(node *anode) *anode {
+    number := node.number
+    for number < adaptiveRoot - 1 {
+        next := at.nodes[number+1]
+        if next.weight != node.weight || next.isLeaf() != node.isLeaf() {
+            break
+        }
+        number++
+    }
+    return at.nodes[number]
+}
+
+// slideAndIncrement moves 'node' ahead of the block it must precede once its
+// weight is incremented, increments it, and returns the next node to process.
+func (at *adaptiveTree) slideAndIncrement(node *anode) *anode {
+    weight := node.weight
+    formerParent := node.parent
+    for node.number < adaptiveRoot - 1 {
+        next := at.nodes[node.number+1]
+        if next == node.parent {
+            break
+        }
+        if node.isLeaf() && !next.isLeaf() && next.weight == weight {
+            at.swap(node, next)
+        } else if !node.isLeaf() && next.isLeaf() && next.weight == weight + 1 {
+            at.swap(node, next)
+        } else {
+            break
+        }
+    }
+    node.weight++
+    if node.isLeaf() {
+        return node.parent
+    }
+    return formerParent
+}
+
+func (at *adaptiveTree) update(symbol int) {
+    var leafToIncrement *anode
+    node := at.leaves[symbol]
+    if node == nil {
+        // Splits the NYT node into an internal node whose children are the
+        // new NYT node and the leaf of the new symbol.
+        number := at.nyt.number
+        internal := at.nyt
+        leaf := &anode{parent: internal, symbol: symbol, number: number - 1}
+        nyt := &anode{parent: internal, symbol: -1, number: number - 2}
+        internal.left = nyt
+        internal.right = leaf
+        at.nodes[number-1] = leaf
+        at.nodes[number-2] = nyt
+        at.leaves[symbol] = leaf
+        at.nyt = nyt
+        node = internal
+        leafToIncrement = leaf
+    } else {
+        if leader := at.leader(node); leader != node {
+            at.swap(node, leader)
+        }
+        if node.parent != nil && (node.parent.left == at.nyt || node.parent.right == at.nyt) {
+            leafToIncrement = node
+            node = node.parent
+        }
+    }
+
+    for node != nil && node != at.root() {
+        node = at.slideAndIncrement(node)
+    }
+    at.root().weight++
+
+    if leafToIncrement != nil {
+        at.slideAndIncrement(leafToIncrement)
+    }
+}
+
+func (at *adaptiveTree) writeCode(bw *bitstream.BitWriter, node *anode) error {
+    var path []bitstream.Bit
+    for ; node.parent != nil; node = node.parent {
+        path = append(path, bitstream.Bit(node.parent.right == node))
+    }
+    for i := len(path) - 1; i >= 0; i-- {
+        if err := bw.WriteBit(path[i]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (at *adaptiveTree) encode(bw *bitstream.BitWriter, symbol int) error {
+    if leaf := at.leaves[symbol]; leaf != nil {
+        if err := at.writeCode(bw, leaf); err != nil {
+            return err
+        }
+    } else {
+        if err := at.writeCode(bw, at.nyt); err != nil {
+            return err
+        }
+        if err := bw.WriteBits(uint64(symbol), adaptiveSymbolBits); err != nil {
+            return err
+        }
+    }
+    at.update(symbol)
+    return nil
+}
+
+func (at *adaptiveTree) decode(br *bitstream.BitReader) (int, error) {
+    node := at.root()
+    for !node.isLeaf() {
+        bit, err := br.ReadBit()
+        if err == io.EOF {
+            return 0, ErrTruncatedData
+        }
+        if err != nil {
+            return 0, err
+        }
+        if bit == bitstream.Zero {
+            node = node.left
+        } else {
+            node = node.right
+        }
+    }
+
+    symbol := node.symbol
+    if node == at.nyt {
+        raw, err := br.ReadBits(adaptiveSymbolBits)
+        if err == io.EOF {
+            return 0, ErrTruncatedData
+        }
+        if err != nil {
+            return 0, err
+        }
+        if raw >= adaptiveNumSymbols || at.leaves[raw] != nil {
+            return 0, ErrInvalidCode
+        }
+        symbol = int(raw)
+    }
+    at.update(symbol)
+    return symbol, nil
+}
+
+
+// AdaptiveWriter compresses data in a single pass with adaptive Huffman
+// coding. Close must be called to terminate the stream.
+type AdaptiveWriter struct {
+    bw *bitstream.BitWriter
+    tree *adaptiveTree
+    closed bool
+}
+
+func NewAdaptiveWriter(writer io.Writer) *AdaptiveWriter {
+    aw := new(AdaptiveWriter)
+    aw.bw = bitstream.NewWriter(writer)
+    aw.tree = newAdaptiveTree()
+    return aw
+}
+
+func (aw *AdaptiveWriter) Write(p []byte) (int, error) {
+    if aw.closed {
+        return 0, io.ErrClosedPipe
+    }
+    for i := 0; i < len(p); i++ {
+        if err := aw.tree.encode(aw.bw, int(p[i])); err != nil {
+            return i, err
+        }
+    }
+    return len(p), nil
+}
+
+// Close writes the end-of-stream symbol and pads the last byte with zeros.
+// It does not close the underlying writer.
+func (aw *AdaptiveWriter) Close() error {
+    if aw.closed {
+        return nil
+    }
+    aw.closed = true
+    if err := aw.tree.encode(aw.bw, AdaptiveEOF); err != nil {
+        return err
+    }
+    logging.Trace.Printf("AdaptiveWriter.Close() root weight %d\n", aw.tree.root().weight)
+    return aw.bw.Flush(bitstream.Zero)
+}
+
+
+// AdaptiveReader decompresses a stream written by AdaptiveWriter. It stops
+// at the end-of-stream symbol, without reading past the byte holding it.
+type AdaptiveReader struct {
+    br *bitstream.BitReader
+    tree *adaptiveTree
+    eof bool
+}
+
+func NewAdaptiveReader(reader io.Reader) *AdaptiveReader {
+    ar := new(AdaptiveReader)
+    ar.br = bitstream.NewReader(reader)
+    ar.tree = newAdaptiveTree()
+    return ar
+}
+
+func (ar *AdaptiveReader) Read(p []byte) (int, error) {
+    if ar.eof {
+        return 0, io.EOF
+    }
+    for i := 0; i < len(p); i++ {
+        symbol, err := ar.tree.decode(ar.br)
+        if err != nil {
+            return i, err
+        }
+        if symbol == AdaptiveEOF {
+            ar.eof = true
+            if i == 0 {
+                return 0, io.EOF
+            }
+            return i, nil
+        }
+        p[i] = byte(symbol)
+    }
+    return len(p), nil
+}
@@ -0,0 +1,141 @@
+package huffman
+
+import (
+    "bytes"
+    "io"
+    "io/ioutil"
+    "math/rand"
+    "testing"
+)
+
+func adaptiveRoundTrip(t *testing.T, originalData []byte) []byte {
+    var buf bytes.Buffer
+    aw := NewAdaptiveWriter(&buf)
+    if _, err := aw.Write(originalData); err != nil {
+        t.Fatal(err)
+    }
+    if err := aw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    encodedData := buf.Bytes()
+
+    decodedData, err := ioutil.ReadAll(NewAdaptiveReader(bytes.NewReader(encodedData)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if bytes.Equal(originalData, decodedData) == false {
+        t.Errorf("Compression failed")
+    }
+    return encodedData
+}
+
+// checkSiblingProperty verifies the invariants of Vitter's algorithm: weights
+// never decrease with the implicit numbering, leaves come before internal
+// nodes of the same weight, and internal nodes weigh as much as their children.
+func checkSiblingProperty(t *testing.T, at *adaptiveTree) {
+    for number := at.nyt.number; number < adaptiveRoot; number++ {
+        node, next := at.nodes[number], at.nodes[number+1]
+        if node.weight > next.weight {
+            t.Fatalf("Node %d weighs more than node %d", number, number+1)
+        }
+        if node.weight == next.weight && !node.isLeaf() && next.isLeaf() {
+            t.Fatalf("Internal node %d comes before leaf %d of the same weight", number, number+1)
+        }
+    }
+    for number := at.nyt.number; number <= adaptiveRoot; number++ {
+        node := at.nodes[number]
+        if node.number != number {
+            t.Fatalf("Node at position %d has number %d", number, node.number)
+        }
+        if !node.isLeaf() && node.weight != node.left.weight + node.right.weight {
+            t.Fatalf("Internal node %d does not weigh as much as its children", number)
+        }
+    }
+}
+
+func TestAdaptiveRoundTrip(t *testing.T) {
+    tests := []string {
+        "",
+        "a",
+        "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+        "Hello World! I really like to say Hello to this World!",
+        "abracadabra",
+    }
+    for _, test := range tests {
+        adaptiveRoundTrip(t, []byte(test))
+    }
+
+    allAlphabet := make([]byte, 1024)
+    for i := range allAlphabet {
+        allAlphabet[i] = byte(i)
+    }
+    adaptiveRoundTrip(t, allAlphabet)
+}
+
+func TestAdaptiveSiblingProperty(t *testing.T) {
+    rand.Seed(7)
+    at := newAdaptiveTree()
+    for i := 0; i < 20000; i++ {
+        // Skewed distribution so that weights keep reordering the tree
+        symbol := int(rand.ExpFloat64() * 20) % 256
+        at.update(symbol)
+        checkSiblingProperty(t, at)
+    }
+}
+
+func TestAdaptiveCompresses(t *testing.T) {
+    rand.Seed(11)
+    originalData := make([]byte, 100000)
+    for i := range originalData {
+        originalData[i] = "aaaaaaaabbbbcc d"[rand.Intn(16)]
+    }
+    encodedData := adaptiveRoundTrip(t, originalData)
+
+    // Entropy of the source is 2.125 bits per symbol
+    if len(encodedData) > len(originalData) * 22 / 80 {
+        t.Errorf("Encoded data is too large: %d bytes for %d bytes of input", len(encodedData), len(originalData))
+    }
+}
+
+func TestAdaptiveSelfTerminating(t *testing.T) {
+    var buf bytes.Buffer
+    aw := NewAdaptiveWriter(&buf)
+    aw.Write([]byte("first stream"))
+    aw.Close()
+    buf.WriteString("trailing data")
+
+    r := bytes.NewReader(buf.Bytes())
+    decodedData, err := ioutil.ReadAll(NewAdaptiveReader(r))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(decodedData) != "first stream" {
+        t.Errorf("Compression failed")
+    }
+    trailing, _ := ioutil.ReadAll(r)
+    if string(trailing) != "trailing data" {
+        t.Errorf("Reader consumed data past the end of the stream: %q", trailing)
+    }
+}
+
+func TestAdaptiveTruncated(t *testing.T) {
+    var buf bytes.Buffer
+    aw := NewAdaptiveWriter(&buf)
+    aw.Write([]byte("Hello World!"))
+    aw.Close()
+    encodedData := buf.Bytes()
+
+    ar := NewAdaptiveReader(bytes.NewReader(encodedData[:len(encodedData)-2]))
+    if _, err := ioutil.ReadAll(ar); err != ErrTruncatedData {
+        t.Errorf("Expected ErrTruncatedData, found %v", err)
+    }
+
+    // 9 raw bits with value 0x1ff are not a valid symbol
+    ar = NewAdaptiveReader(bytes.NewReader([]byte{0xff, 0x80}))
+    if _, err := ar.Read(make([]byte, 1)); err != ErrInvalidCode {
+        t.Errorf("Expected ErrInvalidCode, found %v", err)
+    }
+    if _, err := NewAdaptiveReader(bytes.NewReader(nil)).Read(make([]byte, 1)); err == io.EOF {
+        t.Errorf("Empty input should not be a valid stream")
+    }
+}
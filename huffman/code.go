@@ -0,0 +1,330 @@
+package huffman
+
+import (
+    "errors"
+    "io"
+    "sort"
+
+    "github.com/dgryski/go-bitstream"
+)
+
+// MaxCodeBits is the length limit used by NewCode, so that every code fits
+// in the uint64 given to the bit writer.
+const MaxCodeBits = 64
+
+var (
+    ErrTooManySymbols = errors.New("Alphabet has too many symbols for the maximum code length")
+    ErrInvalidLengths = errors.New("Code lengths do not describe a valid prefix code")
+)
+
+
+// Code is a canonical Huffman code over the symbols 0 to n-1. Symbols with
+// a code length of 0 have no code.
+type Code struct {
+    lengths []int
+    codes []uint64
+    maxBits int
+
+    // Decoding tables: number of codes of each length, and the symbols
+    // sorted by code length then by symbol value.
+    counts []int
+    sorted []int
+}
+
+// NewCode builds a Huffman code from the frequency of every symbol. Symbols
+// with a frequency of 0 get no code. When a single symbol has a non-zero
+// frequency, it gets a 1-bit code.
+func NewCode(freqs []uint64) (*Code, error) {
+    return NewLimitedCode(freqs, MaxCodeBits)
+}
+
+// NewLimitedCode builds an optimal code for 'freqs' in which no code is longer
+// than 'maxBits', as DEFLATE requires with its 15-bit and 7-bit limits.
+func NewLimitedCode(freqs []uint64, maxBits int) (*Code, error) {
+    c := new(Code)
+    var b Builder
+    if err := b.Build(c, freqs, maxBits); err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
+// NewCodeFromLengths builds the canonical code having the given code lengths,
+// as described in RFC 1951, section 3.2.2.
+func NewCodeFromLengths(lengths []int) (*Code, error) {
+    c := new(Code)
+    if err := c.set(lengths); err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
+// set makes 'c' the canonical code having the given code lengths, reusing
+// its memory.
+func (c *Code) set(lengths []int) error {
+    c.lengths = append(c.lengths[:0], lengths...)
+    c.maxBits = 0
+    for _, length := range lengths {
+        if length < 0 || length > MaxCodeBits {
+            return ErrInvalidLengths
+        }
+        if length > c.maxBits {
+            c.maxBits = length
+        }
+    }
+
+    c.counts = zeroInts(c.counts, c.maxBits+1)
+    for _, length := range lengths {
+        c.counts[length] += 1
+    }
+    c.counts[0] = 0
+
+    // Checks that the code is not over-subscribed (Kraft inequality)
+    left := uint64(1)
+    for bits := 1; bits <= c.maxBits; bits++ {
+        left <<= 1
+        if uint64(c.counts[bits]) > left {
+            return ErrInvalidLengths
+        }
+        left -= uint64(c.counts[bits])
+    }
+
+    // First code, and first index in 'sorted', of each length
+    var nextCode [MaxCodeBits+1]uint64
+    var nextIndex [MaxCodeBits+1]int
+    code := uint64(0)
+    for bits := 1; bits <= c.maxBits; bits++ {
+        code = (code + uint64(c.counts[bits-1])) << 1
+        nextCode[bits] = code
+        nextIndex[bits] = nextIndex[bits-1] + c.counts[bits-1]
+    }
+
+    if cap(c.codes) < len(lengths) {
+        c.codes = make([]uint64, len(lengths))
+    }
+    c.codes = c.codes[:len(lengths)]
+    c.sorted = zeroInts(c.sorted, nextIndex[c.maxBits] + c.counts[c.maxBits])
+    for symbol, length := range lengths {
+        c.codes[symbol] = 0
+        if length > 0 {
+            c.codes[symbol] = nextCode[length]
+            nextCode[length] += 1
+            c.sorted[nextIndex[length]] = symbol
+            nextIndex[length] += 1
+        }
+    }
+    return nil
+}
+
+// zeroInts returns 'n' zeros, in the memory of 's' if it is big enough.
+func zeroInts(s []int, n int) []int {
+    if cap(s) < n {
+        return make([]int, n)
+    }
+    s = s[:n]
+    for i := range s {
+        s[i] = 0
+    }
+    return s
+}
+
+// Len returns the number of symbols in the alphabet.
+func (c *Code) Len() int {
+    return len(c.lengths)
+}
+
+// Lengths returns the code length of every symbol.
+func (c *Code) Lengths() []int {
+    out := make([]int, len(c.lengths))
+    copy(out, c.lengths)
+    return out
+}
+
+// AppendLengths appends the code length of every symbol to 'dst', which
+// avoids the copy Lengths makes.
+func (c *Code) AppendLengths(dst []int) []int {
+    return append(dst, c.lengths...)
+}
+
+// Bits returns the code of 'symbol' in the low 'nbits' bits of 'code', most
+// significant bit first.
+func (c *Code) Bits(symbol int) (code uint64, nbits int) {
+    return c.codes[symbol], c.lengths[symbol]
+}
+
+func (c *Code) Encode(bw *bitstream.BitWriter, symbol int) error {
+    if symbol < 0 || symbol >= len(c.lengths) || c.lengths[symbol] == 0 {
+        return ErrSymbolNotInTree
+    }
+    return bw.WriteBits(c.codes[symbol], c.lengths[symbol])
+}
+
+func (c *Code) EncodeSymbols(bw *bitstream.BitWriter, symbols []int) error {
+    for _, symbol := range symbols {
+        if err := c.Encode(bw, symbol); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Decode reads one code, bit by bit, using the counts of codes per length
+// like the 'puff' decoder of zlib.
+func (c *Code) Decode(br *bitstream.BitReader) (int, error) {
+    code := uint64(0)
+    first := uint64(0)
+    index := 0
+    for bits := 1; bits <= c.maxBits; bits++ {
+        bit, err := br.ReadBit()
+        if err == io.EOF {
+            if bits == 1 {
+                return 0, io.EOF
+            }
+            return 0, ErrTruncatedData
+        }
+        if err != nil {
+            return 0, err
+        }
+        if bit == bitstream.One {
+            code |= 1
+        }
+        count := uint64(c.counts[bits])
+        if code - first < count {
+            return c.sorted[index + int(code - first)], nil
+        }
+        index += int(count)
+        first = (first + count) << 1
+        code <<= 1
+    }
+    return 0, ErrInvalidCode
+}
+
+// DecodeSymbols reads 'n' symbols. Running out of input is reported as
+// ErrTruncatedData.
+func (c *Code) DecodeSymbols(br *bitstream.BitReader, n int) ([]int, error) {
+    symbols := make([]int, 0, n)
+    for i := 0; i < n; i++ {
+        symbol, err := c.Decode(br)
+        if err == io.EOF {
+            return symbols, ErrTruncatedData
+        }
+        if err != nil {
+            return symbols, err
+        }
+        symbols = append(symbols, symbol)
+    }
+    return symbols, nil
+}
+
+
+// Builder builds length-limited codes. It keeps the memory of the
+// package-merge algorithm from one code to the next, and reuses the memory
+// of the codes it rebuilds, so building many codes allocates little.
+type Builder struct {
+    items []pmItem
+    leaves []int32
+    list []int32
+    merged []int32
+    stack []int32
+    lengths []int
+}
+
+// Build makes 'c' an optimal code for 'freqs' in which no code is longer
+// than 'maxBits', as NewLimitedCode does.
+func (b *Builder) Build(c *Code, freqs []uint64, maxBits int) error {
+    if maxBits < 1 || maxBits > MaxCodeBits {
+        return ErrInvalidLengths
+    }
+    if err := b.codeLengths(freqs, maxBits); err != nil {
+        return err
+    }
+    return c.set(b.lengths)
+}
+
+// pmItem is an item of the package-merge algorithm: either a leaf, or a
+// package of the items 'left' and 'right' of the previous list, which are
+// indices in Builder.items.
+type pmItem struct {
+    weight uint64
+    symbol int
+    left int32 // -1 for a leaf
+    right int32
+}
+
+// leavesByWeight sorts the leaves of a Builder by weight.
+type leavesByWeight Builder
+
+func (l *leavesByWeight) Len() int {
+    return len(l.leaves)
+}
+
+func (l *leavesByWeight) Less(i, j int) bool {
+    return l.items[l.leaves[i]].weight < l.items[l.leaves[j]].weight
+}
+
+func (l *leavesByWeight) Swap(i, j int) {
+    l.leaves[i], l.leaves[j] = l.leaves[j], l.leaves[i]
+}
+
+// codeLengths computes optimal length-limited code lengths into b.lengths
+// with the package-merge algorithm of Larmore and Hirschberg.
+func (b *Builder) codeLengths(freqs []uint64, maxBits int) error {
+    b.lengths = zeroInts(b.lengths, len(freqs))
+
+    b.items = b.items[:0]
+    b.leaves = b.leaves[:0]
+    for symbol, freq := range freqs {
+        if freq > 0 {
+            b.leaves = append(b.leaves, int32(len(b.items)))
+            b.items = append(b.items, pmItem{weight: freq, symbol: symbol, left: -1})
+        }
+    }
+    leaves := b.leaves
+    if len(leaves) == 0 {
+        return nil
+    }
+    if len(leaves) == 1 {
+        b.lengths[b.items[leaves[0]].symbol] = 1
+        return nil
+    }
+    if maxBits < 64 && len(leaves) > 1 << uint(maxBits) {
+        return ErrTooManySymbols
+    }
+    sort.Stable((*leavesByWeight)(b))
+
+    list := append(b.list[:0], leaves...)
+    merged := b.merged[:0]
+    for bits := 1; bits < maxBits; bits++ {
+        // The packages of the list, in increasing weights, are merged with
+        // the leaves as they are made
+        merged = merged[:0]
+        i := 0
+        for j := 0; j + 1 < len(list); j += 2 {
+            weight := b.items[list[j]].weight + b.items[list[j+1]].weight
+            for i < len(leaves) && b.items[leaves[i]].weight <= weight {
+                merged = append(merged, leaves[i])
+                i++
+            }
+            merged = append(merged, int32(len(b.items)))
+            b.items = append(b.items, pmItem{weight: weight, symbol: -1, left: list[j], right: list[j+1]})
+        }
+        merged = append(merged, leaves[i:]...)
+        list, merged = merged, list
+    }
+    b.list, b.merged = list, merged
+
+    // Every occurrence of a leaf in the first 2n-2 items adds one bit to the
+    // length of its symbol.
+    stack := append(b.stack[:0], list[:2*len(leaves)-2]...)
+    for len(stack) > 0 {
+        item := b.items[stack[len(stack)-1]]
+        stack = stack[:len(stack)-1]
+        if item.left < 0 {
+            b.lengths[item.symbol] += 1
+        } else {
+            stack = append(stack, item.left, item.right)
+        }
+    }
+    b.stack = stack
+    return nil
+}
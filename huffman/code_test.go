@@ -0,0 +1,164 @@
+package huffman
+
+import (
+    "bytes"
+    "math/rand"
+    "testing"
+
+    "github.com/dgryski/go-bitstream"
+)
+
+func codeRoundTrip(t *testing.T, c *Code, symbols []int) {
+    var buf bytes.Buffer
+    bw := bitstream.NewWriter(&buf)
+    if err := c.EncodeSymbols(bw, symbols); err != nil {
+        t.Fatal(err)
+    }
+    bw.Flush(bitstream.Zero)
+
+    br := bitstream.NewReader(bytes.NewReader(buf.Bytes()))
+    decoded, err := c.DecodeSymbols(br, len(symbols))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for i := range symbols {
+        if symbols[i] != decoded[i] {
+            t.Fatalf("Compression failed at symbol %d: expected %d, found %d", i, symbols[i], decoded[i])
+        }
+    }
+}
+
+func TestCodeLengths(t *testing.T) {
+    // Example from RFC 1951, section 3.2.2: lengths (3, 3, 3, 3, 3, 2, 4, 4)
+    // give the codes 010, 011, 100, 101, 110, 00, 1110, 1111.
+    c, err := NewCodeFromLengths([]int{3, 3, 3, 3, 3, 2, 4, 4})
+    if err != nil {
+        t.Fatal(err)
+    }
+    expected := []uint64{2, 3, 4, 5, 6, 0, 14, 15}
+    for symbol, code := range expected {
+        if found, _ := c.Bits(symbol); found != code {
+            t.Errorf("For symbol %d, expected code %b and found %b", symbol, code, found)
+        }
+    }
+
+    if _, err := NewCodeFromLengths([]int{1, 1, 1}); err != ErrInvalidLengths {
+        t.Errorf("Expected ErrInvalidLengths for an over-subscribed code, found %v", err)
+    }
+}
+
+func TestCodeRoundTrip(t *testing.T) {
+    rand.Seed(5)
+    for _, numSymbols := range []int{2, 30, 286, 1000} {
+        freqs := make([]uint64, numSymbols)
+        var symbols []int
+        for i := 0; i < 5000; i++ {
+            symbol := int(rand.ExpFloat64() * float64(numSymbols) / 8) % numSymbols
+            freqs[symbol] += 1
+            symbols = append(symbols, symbol)
+        }
+        c, err := NewCode(freqs)
+        if err != nil {
+            t.Fatal(err)
+        }
+        codeRoundTrip(t, c, symbols)
+    }
+}
+
+func TestLimitedCode(t *testing.T) {
+    // Fibonacci frequencies give a Huffman code as deep as the alphabet
+    freqs := make([]uint64, 30)
+    freqs[0], freqs[1] = 1, 1
+    for i := 2; i < len(freqs); i++ {
+        freqs[i] = freqs[i-1] + freqs[i-2]
+    }
+
+    unlimited, err := NewCode(freqs)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if unlimited.maxBits != len(freqs) - 1 {
+        t.Errorf("Expected a maximum length of %d, found %d", len(freqs) - 1, unlimited.maxBits)
+    }
+
+    for _, maxBits := range []int{5, 7, 15} {
+        c, err := NewLimitedCode(freqs, maxBits)
+        if err != nil {
+            t.Fatal(err)
+        }
+        kraft := 0.0
+        for _, length := range c.Lengths() {
+            if length > maxBits {
+                t.Errorf("Code length %d is above the limit of %d", length, maxBits)
+            }
+            kraft += 1.0 / float64(uint64(1) << uint(length))
+        }
+        if kraft != 1.0 {
+            t.Errorf("Code with a limit of %d bits is not complete", maxBits)
+        }
+        codeRoundTrip(t, c, []int{0, 1, 29, 28, 3, 0})
+    }
+
+    if _, err := NewLimitedCode(freqs, 4); err != ErrTooManySymbols {
+        t.Errorf("Expected ErrTooManySymbols, found %v", err)
+    }
+}
+
+func TestBuilderReuse(t *testing.T) {
+    // Codes rebuilt in the same memory are the codes built anew
+    r := rand.New(rand.NewSource(3))
+    var b Builder
+    var c Code
+    for i := 0; i < 50; i++ {
+        freqs := make([]uint64, 1 + r.Intn(300))
+        for symbol := range freqs {
+            if r.Intn(3) > 0 {
+                freqs[symbol] = uint64(r.Intn(1000))
+            }
+        }
+        expected, err := NewLimitedCode(freqs, 15)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if err := b.Build(&c, freqs, 15); err != nil {
+            t.Fatal(err)
+        }
+        for symbol := range freqs {
+            code, nbits := c.Bits(symbol)
+            expectedCode, expectedBits := expected.Bits(symbol)
+            if code != expectedCode || nbits != expectedBits {
+                t.Fatalf("Code %d, symbol %d: expected %d bits, found %d", i, symbol, expectedBits, nbits)
+            }
+        }
+        if len(c.sorted) != len(expected.sorted) || c.Len() != len(freqs) {
+            t.Fatalf("Code %d: the decoding tables differ", i)
+        }
+    }
+}
+
+func TestCodeDegenerate(t *testing.T) {
+    c, err := NewCode(make([]uint64, 10))
+    if err != nil {
+        t.Fatal(err)
+    }
+    var buf bytes.Buffer
+    if err := c.Encode(bitstream.NewWriter(&buf), 3); err != ErrSymbolNotInTree {
+        t.Errorf("Expected ErrSymbolNotInTree, found %v", err)
+    }
+
+    freqs := make([]uint64, 10)
+    freqs[7] = 42
+    c, err = NewCode(freqs)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, nbits := c.Bits(7); nbits != 1 {
+        t.Errorf("Expected a 1-bit code for a single symbol, found %d bits", nbits)
+    }
+    codeRoundTrip(t, c, []int{7, 7, 7})
+
+    br := bitstream.NewReader(bytes.NewReader([]byte{0x80}))
+    if _, err := c.Decode(br); err != ErrInvalidCode {
+        t.Errorf("Expected ErrInvalidCode, found %v", err)
+    }
+}
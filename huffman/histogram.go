@@ -0,0 +1,106 @@
+package huffman
+
+import (
+    "encoding/binary"
+    "errors"
+    "io"
+)
+
+var ErrInvalidHistogram = errors.New("Invalid serialized histogram")
+
+
+// Histogram holds the frequency of every byte value. Histograms computed on
+// separate samples can be merged, and a histogram can be serialized to ship a
+// pre-trained table instead of storing a table along with every message.
+type Histogram [256]uint64
+
+func (h *Histogram) AddBytes(data []byte) {
+    for _, b := range data {
+        h[b] += 1
+    }
+}
+
+// AddReader adds the bytes of 'reader' until io.EOF.
+func (h *Histogram) AddReader(reader io.Reader) error {
+    buffer := make([]byte, 1024)
+    for {
+        n, err := reader.Read(buffer)
+        h.AddBytes(buffer[:n])
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+    }
+}
+
+func (h *Histogram) Merge(other *Histogram) {
+    for i := range h {
+        h[i] += other[i]
+    }
+}
+
+func (h *Histogram) Total() uint64 {
+    var total uint64 = 0
+    for _, frequency := range h {
+        total += frequency
+    }
+    return total
+}
+
+// MarshalBinary serializes the histogram as 256 uvarints.
+func (h *Histogram) MarshalBinary() ([]byte, error) {
+    out := make([]byte, 0, 256)
+    buffer := make([]byte, binary.MaxVarintLen64)
+    for _, frequency := range h {
+        n := binary.PutUvarint(buffer, frequency)
+        out = append(out, buffer[:n]...)
+    }
+    return out, nil
+}
+
+func (h *Histogram) UnmarshalBinary(data []byte) error {
+    var histogram Histogram
+    for i := range histogram {
+        frequency, n := binary.Uvarint(data)
+        if n <= 0 {
+            return ErrInvalidHistogram
+        }
+        histogram[i] = frequency
+        data = data[n:]
+    }
+    if len(data) != 0 {
+        return ErrInvalidHistogram
+    }
+    *h = histogram
+    return nil
+}
+
+
+// TrainHistogram merges the histograms of all the samples of a corpus. Every
+// byte value is counted at least once, so that the trees built from the
+// result can encode any input, including bytes absent from the corpus.
+func TrainHistogram(samples ...io.Reader) (*Histogram, error) {
+    histogram := new(Histogram)
+    for i := range histogram {
+        histogram[i] = 1
+    }
+    for _, sample := range samples {
+        var h Histogram
+        if err := h.AddReader(sample); err != nil {
+            return nil, err
+        }
+        histogram.Merge(&h)
+    }
+    return histogram, nil
+}
+
+// TrainHTree builds a static tree from a corpus of samples, see TrainHistogram.
+func TrainHTree(samples ...io.Reader) (*HTree, error) {
+    histogram, err := TrainHistogram(samples...)
+    if err != nil {
+        return nil, err
+    }
+    return BuildHTreeFromHistogram(histogram)
+}
@@ -0,0 +1,110 @@
+package huffman
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+func TestHistogramMerge(t *testing.T) {
+    samples := []string {
+        "{\"temperature\": 21, \"unit\": \"C\"}",
+        "{\"temperature\": 19, \"unit\": \"C\"}",
+        "{\"humidity\": 40}",
+    }
+
+    var merged, all Histogram
+    for _, sample := range samples {
+        var h Histogram
+        if err := h.AddReader(strings.NewReader(sample)); err != nil {
+            t.Fatal(err)
+        }
+        merged.Merge(&h)
+    }
+    all.AddBytes([]byte(strings.Join(samples, "")))
+
+    if merged != all {
+        t.Errorf("Merged histogram differs from the histogram of the concatenated samples")
+    }
+    if merged.Total() != uint64(len(strings.Join(samples, ""))) {
+        t.Errorf("Invalid total %d", merged.Total())
+    }
+}
+
+func TestHistogramMarshal(t *testing.T) {
+    var h Histogram
+    h.AddBytes([]byte("Hello World!"))
+    h[200] = 1 << 40
+
+    data, err := h.MarshalBinary()
+    if err != nil {
+        t.Fatal(err)
+    }
+    var h2 Histogram
+    if err := h2.UnmarshalBinary(data); err != nil {
+        t.Fatal(err)
+    }
+    if h != h2 {
+        t.Errorf("Histogram changed after serialization")
+    }
+
+    if err := h2.UnmarshalBinary(data[:len(data)-1]); err != ErrInvalidHistogram {
+        t.Errorf("Expected ErrInvalidHistogram, found %v", err)
+    }
+}
+
+func TestHistogramDeterministic(t *testing.T) {
+    var h Histogram
+    h.AddBytes([]byte("abcdefgh abcdefgh abcd"))
+
+    // Trees built from the same histogram must give the same codes, or a
+    // shipped table could not be used to decode.
+    reference, err := BuildHTreeFromHistogram(&h)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for i := 0; i < 20; i++ {
+        htree, err := BuildHTreeFromHistogram(&h)
+        if err != nil {
+            t.Fatal(err)
+        }
+        for k, v := range *reference.encodedDictionary {
+            if (*htree.encodedDictionary)[k] != v {
+                t.Fatalf("Code of %q differs between two trees built from the same histogram", k)
+            }
+        }
+    }
+}
+
+func TestTrainHTree(t *testing.T) {
+    corpus := []string {
+        "{\"id\": 1, \"status\": \"ok\", \"load\": 0.5}",
+        "{\"id\": 2, \"status\": \"ok\", \"load\": 0.7}",
+        "{\"id\": 3, \"status\": \"degraded\", \"load\": 0.9}",
+    }
+    var samples []*strings.Reader
+    for _, sample := range corpus {
+        samples = append(samples, strings.NewReader(sample))
+    }
+    htree, err := TrainHTree(samples[0], samples[1], samples[2])
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // A message with bytes that are absent from the corpus
+    message := "{\"id\": 42, \"status\": \"ok\", \"load\": 0.1, \"zone\": \"Q\"}\x00\xff"
+    encodedData, nbits, err := htree.EncodeBytes(strings.NewReader(message))
+    if err != nil {
+        t.Fatal(err)
+    }
+    decodedData, err := htree.DecodeBytes(*encodedData, nbits)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if bytes.Equal([]byte(message), *decodedData) == false {
+        t.Errorf("Compression failed")
+    }
+    if len(*encodedData) >= len(message) {
+        t.Errorf("Trained table did not compress the message: %d bytes for %d bytes of input", len(*encodedData), len(message))
+    }
+}
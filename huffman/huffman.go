@@ -5,6 +5,7 @@ import (
     "io"
     "strconv"
     "bytes"
+    "errors"
     "container/heap"
 
     "github.com/goossaert/compression/logging"
@@ -12,6 +13,13 @@ import (
 )
 
 
+var (
+    ErrSymbolNotInTree = errors.New("Symbol is not present in the Huffman tree")
+    ErrInvalidCode = errors.New("Encoded data contains a code that is not in the Huffman tree")
+    ErrTruncatedData = errors.New("Encoded data ends in the middle of a code")
+)
+
+
 type HNode struct {
     parent *HNode
     left *HNode
@@ -77,34 +85,57 @@ type Transcode struct {
     nbits int
 }
 
+// maxTreeDepth is the length of the longest code a Transcode holds.
+const maxTreeDepth = 32
 
-func BuildHTree(reader io.Reader) *HTree {
+
+// BuildHTree reads all of 'reader' and builds a Huffman tree from the byte
+// frequencies. Empty input gives a tree with no symbols, which can only encode
+// empty input. Input with a single distinct byte gives that byte a 1-bit code.
+func BuildHTree(reader io.Reader) (*HTree, error) {
     // 1. Builds frequency tables
-    freqs := make(map[byte]int)
-    buffer := make([]byte, 1024)
-    for {
-        n, err := reader.Read(buffer)
-        if err == io.EOF {
-            break
-        }
-        for i := 0 ; i < n ; i++ {
-            freqs[buffer[i]] += 1
+    var histogram Histogram
+    if err := histogram.AddReader(reader); err != nil {
+        return nil, err
+    }
+    return BuildHTreeFromHistogram(&histogram)
+}
+
+
+// BuildHTreeFromHistogram builds a Huffman tree from precomputed byte
+// frequencies. Ties between frequencies are broken by byte value, so a given
+// histogram always gives the same tree.
+func BuildHTreeFromHistogram(histogram *Histogram) (*HTree, error) {
+    logging.Trace.Printf("%v\n", *histogram)
+
+    numSymbols := 0
+    for _, frequency := range histogram {
+        if frequency > 0 {
+            numSymbols++
         }
     }
-    logging.Trace.Printf("%v\n", freqs)
+
+    if numSymbols == 0 {
+        dictionary := make(map[byte]Transcode)
+        return &HTree{nil, &dictionary}, nil
+    }
 
     // 2. Builds priority queue
-    pq := make(PriorityQueue, len(freqs))
-    i := 0
-    for character, frequency := range freqs {
+    pq := make(PriorityQueue, 0, numSymbols)
+    sequence := 0
+    for character, frequency := range histogram {
+        if frequency == 0 {
+            continue
+        }
         dict := make(map[byte]bool)
-        dict[character] = true
-        node := HNode{nil, nil, nil, frequency, dict}
-        pq[i] = &PQItem{
+        dict[byte(character)] = true
+        node := HNode{nil, nil, nil, int(frequency), dict}
+        pq = append(pq, &PQItem{
                 hnode: &node,
-                index: i,
-        }
-        i++
+                index: sequence,
+                sequence: sequence,
+        })
+        sequence++
     }
     heap.Init(&pq)
 
@@ -128,12 +159,31 @@ func BuildHTree(reader io.Reader) *HTree {
         item1.hnode.parent = node
         item2.hnode.parent = node
 
-        item := &PQItem{hnode: node}
+        item := &PQItem{hnode: node, sequence: sequence}
+        sequence++
         heap.Push(&pq, item)
     }
     last := heap.Pop(&pq).(*PQItem)
     htree := HTree{last.hnode, nil}
 
+    // With a single symbol, the root would be a leaf and get a zero-bit code.
+    // Hanging the leaf on the left of a new root gives it the code '0'.
+    if numSymbols == 1 {
+        root := &HNode{nil, last.hnode, nil, last.hnode.frequency, last.hnode.dict}
+        last.hnode.parent = root
+        htree.root = root
+    }
+
+    // Skewed frequencies, like the Fibonacci numbers, can give codes longer
+    // than a Transcode holds: the tree then follows a length-limited code.
+    if treeDepth(htree.root) > maxTreeDepth {
+        root, err := limitedTree(histogram)
+        if err != nil {
+            return nil, err
+        }
+        htree.root = root
+    }
+
     // 4. Creates bit encoding for every byte in the tree,
     // and stores it into a dictionary
     dictionary := make(map[byte]Transcode)
@@ -189,36 +239,88 @@ func BuildHTree(reader io.Reader) *HTree {
         logging.Trace.Printf("%s %0*s\n", string(k), v.nbits, strconv.FormatUint(uint64(v.encoding), 2))
     }
 
-    return &htree
+    return &htree, nil
+}
+
+
+// treeDepth returns the length of the longest path from 'node' to a leaf.
+func treeDepth(node *HNode) int {
+    if node == nil || (node.left == nil && node.right == nil) {
+        return 0
+    }
+    left, right := treeDepth(node.left), treeDepth(node.right)
+    if right > left {
+        left = right
+    }
+    return left + 1
+}
+
+// limitedTree returns the tree of the optimal code of 'histogram' in which
+// no code is longer than maxTreeDepth bits.
+func limitedTree(histogram *Histogram) (*HNode, error) {
+    code, err := NewLimitedCode(histogram[:], maxTreeDepth)
+    if err != nil {
+        return nil, err
+    }
+    root := &HNode{dict: make(map[byte]bool)}
+    for symbol, frequency := range histogram {
+        bits, nbits := code.Bits(symbol)
+        if nbits == 0 {
+            continue
+        }
+        node := root
+        for i := nbits - 1 ; i >= 0 ; i-- {
+            node.frequency += int(frequency)
+            node.dict[byte(symbol)] = true
+            child := &node.left
+            if (bits >> uint(i)) & 1 == 1 {
+                child = &node.right
+            }
+            if *child == nil {
+                *child = &HNode{parent: node, dict: make(map[byte]bool)}
+            }
+            node = *child
+        }
+        node.frequency = int(frequency)
+        node.dict[byte(symbol)] = true
+    }
+    return root, nil
 }
 
 
-func (htree *HTree) EncodeBytes(reader io.Reader) (encodedData *[]byte, nbits int) {
+// EncodeBytes encodes all of 'reader' with the codes of the tree, and returns
+// the encoded data along with its length in bits. It fails with
+// ErrSymbolNotInTree if the input contains a byte that was not seen when the
+// tree was built.
+func (htree *HTree) EncodeBytes(reader io.Reader) (encodedData *[]byte, nbits int, err error) {
     buf := bytes.NewBuffer(nil)
     bw := bitstream.NewWriter(buf)
     nbitsWritten := 0
 
     buffer := make([]byte, 1024)
     for {
-        n, err := reader.Read(buffer)
-        if err == io.EOF {
-            break
-        }
+        n, errRead := reader.Read(buffer)
         for i := 0 ; i < n ; i++ {
-            if transcode, ok := (*htree.encodedDictionary)[buffer[i]] ; ok == true {
-                err := bw.WriteBits(uint64(transcode.encoding), transcode.nbits)
-                if err != nil {
-                    fmt.Print("Unexpected error")
-                }
-                nbitsWritten += transcode.nbits
-                logging.Trace.Printf("input %s\n", string(buffer[i]))
-
-            } else {
-                panic("error in dictionary\n")
+            transcode, ok := (*htree.encodedDictionary)[buffer[i]]
+            if !ok {
+                return nil, 0, ErrSymbolNotInTree
+            }
+            if err := bw.WriteBits(uint64(transcode.encoding), transcode.nbits); err != nil {
+                return nil, 0, err
             }
+            nbitsWritten += transcode.nbits
+            logging.Trace.Printf("input %s\n", string(buffer[i]))
         }
+        if errRead == io.EOF {
+            break
+        }
+        if errRead != nil {
+            return nil, 0, errRead
+        }
+    }
+    if err := bw.Flush(bitstream.Zero); err != nil {
+        return nil, 0, err
     }
-    bw.Flush(bitstream.Zero)
 
     var out []byte
     for {
@@ -231,45 +333,51 @@ func (htree *HTree) EncodeBytes(reader io.Reader) (encodedData *[]byte, nbits in
     }
     logging.Trace.Printf("\n")
 
-    return &out, nbitsWritten
+    return &out, nbitsWritten, nil
 }
 
 
-func (htree *HTree) DecodeBytes(encodedData []byte, nbits int) *[]byte {
+// DecodeBytes decodes the first 'nbits' bits of 'encodedData'. It fails with
+// ErrTruncatedData if the data ends before 'nbits' bits or in the middle of a
+// code, and with ErrInvalidCode if a code does not lead to a symbol.
+func (htree *HTree) DecodeBytes(encodedData []byte, nbits int) (*[]byte, error) {
+    out := []byte{}
+    if nbits <= 0 {
+        return &out, nil
+    }
+    if htree.root == nil {
+        return nil, ErrInvalidCode
+    }
+
     br := bitstream.NewReader(bytes.NewReader(encodedData))
-    var out []byte
-    isNewChunk := true
     bitsConsumed := 0
-    var node *HNode = nil
-    for {
+    node := htree.root
+    for bitsConsumed < nbits {
         bit, err := br.ReadBit()
         if err == io.EOF {
-            break
+            return nil, ErrTruncatedData
         }
         if err != nil {
-            logging.Trace.Printf("Error while reading bits\n")
-            return nil
-        }
-        if isNewChunk {
-            node = htree.root
-            isNewChunk = false
+            return nil, err
         }
         if bit == bitstream.Zero {
             node = node.left
         } else {
             node = node.right
         }
+        if node == nil {
+            return nil, ErrInvalidCode
+        }
         if node.left == nil && node.right == nil {
             out = append(out, node.Byte())
             logging.Trace.Printf("%s", string(node.Byte()))
-            isNewChunk = true
+            node = htree.root
         }
-
         bitsConsumed += 1
-        if bitsConsumed >= nbits {
-            break
-        }
     }
-    return &out
-}
 
+    if node != htree.root {
+        return nil, ErrTruncatedData
+    }
+    return &out, nil
+}
@@ -10,11 +10,17 @@ func TestSingleString(t *testing.T) {
     originalData := "Hello World!"
 
     r := strings.NewReader(originalData)
-    htree := BuildHTree(r)
+    htree, err := BuildHTree(r)
+    if err != nil {
+        t.Fatal(err)
+    }
     htree.Print()
 
     r2 := strings.NewReader(originalData)
-    encodedData, nbits := htree.EncodeBytes(r2)
+    encodedData, nbits, err := htree.EncodeBytes(r2)
+    if err != nil {
+        t.Fatal(err)
+    }
 
     /*
     import "strconv"
@@ -27,7 +33,10 @@ func TestSingleString(t *testing.T) {
     }
     */
 
-    decodedData := htree.DecodeBytes(*encodedData, nbits)
+    decodedData, err := htree.DecodeBytes(*encodedData, nbits)
+    if err != nil {
+        t.Fatal(err)
+    }
 
     if bytes.Equal([]byte(originalData), *decodedData) == false {
         t.Errorf("Compression failed")
@@ -40,11 +49,11 @@ func BenchmarkSingleString(b *testing.B) {
 
     for i := 0 ; i < b.N ; i++ {
         r := strings.NewReader(originalData)
-        htree := BuildHTree(r)
+        htree, _ := BuildHTree(r)
         htree.Print()
 
         r2 := strings.NewReader(originalData)
-        encodedData, nbits := htree.EncodeBytes(r2)
+        encodedData, nbits, _ := htree.EncodeBytes(r2)
         htree.DecodeBytes(*encodedData, nbits)
     }
 
@@ -58,15 +67,145 @@ func TestAllAlphabet(t *testing.T) {
     }
 
     r := bytes.NewReader(originalData)
-    htree := BuildHTree(r)
+    htree, err := BuildHTree(r)
+    if err != nil {
+        t.Fatal(err)
+    }
     htree.Print()
 
     r2 := bytes.NewReader(originalData)
-    encodedData, nbits := htree.EncodeBytes(r2)
+    encodedData, nbits, err := htree.EncodeBytes(r2)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    decodedData, err := htree.DecodeBytes(*encodedData, nbits)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if bytes.Equal([]byte(originalData), *decodedData) == false {
+        t.Errorf("Compression failed")
+    }
+}
+
+
+func TestEmptyInput(t *testing.T) {
+    htree, err := BuildHTree(strings.NewReader(""))
+    if err != nil {
+        t.Fatal(err)
+    }
+    htree.Print()
+
+    encodedData, nbits, err := htree.EncodeBytes(strings.NewReader(""))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if nbits != 0 || len(*encodedData) != 0 {
+        t.Errorf("Encoding empty input should give no bits, found %d", nbits)
+    }
+
+    decodedData, err := htree.DecodeBytes(*encodedData, nbits)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(*decodedData) != 0 {
+        t.Errorf("Decoding empty input should give no bytes")
+    }
+
+    if _, _, err := htree.EncodeBytes(strings.NewReader("a")); err != ErrSymbolNotInTree {
+        t.Errorf("Expected ErrSymbolNotInTree, found %v", err)
+    }
+    if _, err := htree.DecodeBytes([]byte{0}, 1); err != ErrInvalidCode {
+        t.Errorf("Expected ErrInvalidCode, found %v", err)
+    }
+}
+
+
+func TestSingleSymbol(t *testing.T) {
+    originalData := "aaaaaaaaaaa"
+
+    htree, err := BuildHTree(strings.NewReader(originalData))
+    if err != nil {
+        t.Fatal(err)
+    }
 
-    decodedData := htree.DecodeBytes(*encodedData, nbits)
+    encodedData, nbits, err := htree.EncodeBytes(strings.NewReader(originalData))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if nbits != len(originalData) {
+        t.Errorf("Expected a 1-bit code per symbol, found %d bits for %d symbols", nbits, len(originalData))
+    }
 
+    decodedData, err := htree.DecodeBytes(*encodedData, nbits)
+    if err != nil {
+        t.Fatal(err)
+    }
     if bytes.Equal([]byte(originalData), *decodedData) == false {
         t.Errorf("Compression failed")
     }
+
+    // The code '1' is not assigned to any symbol
+    if _, err := htree.DecodeBytes([]byte{0x80}, 1); err != ErrInvalidCode {
+        t.Errorf("Expected ErrInvalidCode, found %v", err)
+    }
+}
+
+
+func TestDeepTree(t *testing.T) {
+    // Fibonacci frequencies give a Huffman tree as deep as the alphabet
+    var histogram Histogram
+    histogram[0], histogram[1] = 1, 1
+    for i := 2 ; i < 45 ; i++ {
+        histogram[i] = histogram[i-1] + histogram[i-2]
+    }
+    htree, err := BuildHTreeFromHistogram(&histogram)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for symbol, transcode := range *htree.encodedDictionary {
+        if transcode.nbits > maxTreeDepth {
+            t.Errorf("Symbol %d has a code of %d bits", symbol, transcode.nbits)
+        }
+    }
+
+    originalData := []byte{0, 1, 2, 40, 44, 0}
+    encodedData, nbits, err := htree.EncodeBytes(bytes.NewReader(originalData))
+    if err != nil {
+        t.Fatal(err)
+    }
+    decodedData, err := htree.DecodeBytes(*encodedData, nbits)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if bytes.Equal(originalData, *decodedData) == false {
+        t.Errorf("Compression failed: %v", *decodedData)
+    }
+}
+
+
+func TestDecodeErrors(t *testing.T) {
+    originalData := "Hello World!"
+
+    htree, err := BuildHTree(strings.NewReader(originalData))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if _, _, err := htree.EncodeBytes(strings.NewReader("Hello Moon!")); err != ErrSymbolNotInTree {
+        t.Errorf("Expected ErrSymbolNotInTree, found %v", err)
+    }
+
+    encodedData, nbits, err := htree.EncodeBytes(strings.NewReader(originalData))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if _, err := htree.DecodeBytes(*encodedData, nbits + 64); err != ErrTruncatedData {
+        t.Errorf("Expected ErrTruncatedData when reading past the data, found %v", err)
+    }
+    if _, err := htree.DecodeBytes(*encodedData, nbits - 1); err != ErrTruncatedData {
+        t.Errorf("Expected ErrTruncatedData when stopping inside a code, found %v", err)
+    }
 }
@@ -4,6 +4,7 @@ package huffman
 type PQItem struct {
     hnode *HNode
     index int
+    sequence int // insertion order, breaks ties between equal frequencies
 }
 
 type PriorityQueue []*PQItem
@@ -11,7 +12,10 @@ type PriorityQueue []*PQItem
 func (pq PriorityQueue) Len() int { return len(pq) }
 
 func (pq PriorityQueue) Less(i, j int) bool {
-    return pq[i].hnode.frequency < pq[j].hnode.frequency
+    if pq[i].hnode.frequency != pq[j].hnode.frequency {
+        return pq[i].hnode.frequency < pq[j].hnode.frequency
+    }
+    return pq[i].sequence < pq[j].sequence
 }
 
 func (pq PriorityQueue) Swap(i, j int) {
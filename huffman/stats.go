@@ -0,0 +1,159 @@
+package huffman
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "math"
+    "sort"
+    "strconv"
+)
+
+type SymbolStats struct {
+    Symbol byte
+    Frequency uint64
+    Code uint64 // code on the CodeLength low bits, first bit on the left
+    CodeLength int
+}
+
+// Bits returns the code as a string of '0' and '1'.
+func (s SymbolStats) Bits() string {
+    if s.CodeLength == 0 {
+        return ""
+    }
+    return fmt.Sprintf("%0*s", s.CodeLength, strconv.FormatUint(s.Code, 2))
+}
+
+
+// TreeStats tells how well a Huffman tree fits the data it was built from.
+// Entropy and AverageCodeLength are in bits per symbol, and Efficiency is
+// their ratio, 1.0 meaning that the code is as good as the source allows.
+type TreeStats struct {
+    Symbols []SymbolStats // sorted by symbol
+    TotalFrequency uint64
+    Entropy float64
+    AverageCodeLength float64
+    Efficiency float64
+}
+
+// EncodedBits returns the size in bits of the data the tree was built from,
+// once encoded.
+func (ts *TreeStats) EncodedBits() uint64 {
+    var nbits uint64 = 0
+    for _, s := range ts.Symbols {
+        nbits += s.Frequency * uint64(s.CodeLength)
+    }
+    return nbits
+}
+
+
+func (htree *HTree) leaves() []*HNode {
+    var leaves []*HNode
+    var stack []*HNode
+    if htree.root != nil {
+        stack = append(stack, htree.root)
+    }
+    for len(stack) > 0 {
+        node := stack[len(stack)-1]
+        stack = stack[:len(stack)-1]
+        if node.left == nil && node.right == nil {
+            leaves = append(leaves, node)
+            continue
+        }
+        if node.right != nil {
+            stack = append(stack, node.right)
+        }
+        if node.left != nil {
+            stack = append(stack, node.left)
+        }
+    }
+    return leaves
+}
+
+func (htree *HTree) Stats() *TreeStats {
+    ts := new(TreeStats)
+    for _, leaf := range htree.leaves() {
+        symbol := leaf.Byte()
+        transcode := (*htree.encodedDictionary)[symbol]
+        ts.Symbols = append(ts.Symbols, SymbolStats{
+            Symbol: symbol,
+            Frequency: uint64(leaf.frequency),
+            Code: uint64(transcode.encoding),
+            CodeLength: transcode.nbits })
+        ts.TotalFrequency += uint64(leaf.frequency)
+    }
+    sort.Slice(ts.Symbols, func(i, j int) bool {
+        return ts.Symbols[i].Symbol < ts.Symbols[j].Symbol
+    })
+
+    if ts.TotalFrequency == 0 {
+        return ts
+    }
+
+    total := float64(ts.TotalFrequency)
+    for _, s := range ts.Symbols {
+        p := float64(s.Frequency) / total
+        ts.Entropy -= p * math.Log2(p)
+        ts.AverageCodeLength += p * float64(s.CodeLength)
+    }
+    if ts.Entropy == 0 {
+        // math.Log2(1) gives 0 and p*log(p) can give -0
+        ts.Entropy = 0
+    }
+    if ts.AverageCodeLength > 0 {
+        ts.Efficiency = ts.Entropy / ts.AverageCodeLength
+    }
+    return ts
+}
+
+
+func dotSymbol(symbol byte) string {
+    if symbol > ' ' && symbol < 0x7f && symbol != '"' && symbol != '\\' {
+        return fmt.Sprintf("'%c'", symbol)
+    }
+    return fmt.Sprintf("0x%02x", symbol)
+}
+
+// WriteDOT writes the tree in the Graphviz DOT language. Leaves show their
+// symbol and frequency, internal nodes their frequency, and edges the bit
+// they stand for.
+func (htree *HTree) WriteDOT(writer io.Writer) error {
+    w := bufio.NewWriter(writer)
+    fmt.Fprintf(w, "digraph huffman {\n")
+    fmt.Fprintf(w, "    node [fontname=\"monospace\"];\n")
+
+    if htree.root != nil {
+        ids := make(map[*HNode]int)
+        var stack []*HNode
+        stack = append(stack, htree.root)
+        for len(stack) > 0 {
+            node := stack[len(stack)-1]
+            stack = stack[:len(stack)-1]
+            id := len(ids)
+            ids[node] = id
+
+            if node.left == nil && node.right == nil {
+                fmt.Fprintf(w, "    n%d [shape=box, label=\"%s\\n%d\"];\n", id, dotSymbol(node.Byte()), node.frequency)
+            } else {
+                fmt.Fprintf(w, "    n%d [shape=circle, label=\"%d\"];\n", id, node.frequency)
+            }
+            if node.parent != nil {
+                bit := 0
+                if node.parent.right == node {
+                    bit = 1
+                }
+                fmt.Fprintf(w, "    n%d -> n%d [label=\"%d\"];\n", ids[node.parent], id, bit)
+            }
+
+            if node.right != nil {
+                stack = append(stack, node.right)
+            }
+            if node.left != nil {
+                stack = append(stack, node.left)
+            }
+        }
+    }
+
+    fmt.Fprintf(w, "}\n")
+    return w.Flush()
+}
@@ -0,0 +1,88 @@
+package huffman
+
+import (
+    "bytes"
+    "math"
+    "strings"
+    "testing"
+)
+
+func TestStats(t *testing.T) {
+    originalData := "aaaabbc"
+    htree, err := BuildHTree(strings.NewReader(originalData))
+    if err != nil {
+        t.Fatal(err)
+    }
+    ts := htree.Stats()
+
+    expectedLengths := map[byte]int{'a': 1, 'b': 2, 'c': 2}
+    expectedFrequencies := map[byte]uint64{'a': 4, 'b': 2, 'c': 1}
+    if len(ts.Symbols) != 3 {
+        t.Fatalf("Expected 3 symbols, found %d", len(ts.Symbols))
+    }
+    for _, s := range ts.Symbols {
+        if s.CodeLength != expectedLengths[s.Symbol] || s.Frequency != expectedFrequencies[s.Symbol] {
+            t.Errorf("Invalid stats for %q: length %d, frequency %d", s.Symbol, s.CodeLength, s.Frequency)
+        }
+        if len(s.Bits()) != s.CodeLength {
+            t.Errorf("Invalid bits %q for %q", s.Bits(), s.Symbol)
+        }
+    }
+
+    entropy := -(4.0/7 * math.Log2(4.0/7) + 2.0/7 * math.Log2(2.0/7) + 1.0/7 * math.Log2(1.0/7))
+    if math.Abs(ts.Entropy - entropy) > 1e-9 {
+        t.Errorf("Expected entropy %f, found %f", entropy, ts.Entropy)
+    }
+    if math.Abs(ts.AverageCodeLength - 10.0/7) > 1e-9 {
+        t.Errorf("Expected average code length %f, found %f", 10.0/7, ts.AverageCodeLength)
+    }
+    if ts.Efficiency <= 0 || ts.Efficiency > 1 {
+        t.Errorf("Invalid efficiency %f", ts.Efficiency)
+    }
+
+    _, nbits, err := htree.EncodeBytes(strings.NewReader(originalData))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ts.EncodedBits() != uint64(nbits) {
+        t.Errorf("Expected %d encoded bits, found %d", nbits, ts.EncodedBits())
+    }
+}
+
+func TestStatsDegenerate(t *testing.T) {
+    htree, _ := BuildHTree(strings.NewReader(""))
+    ts := htree.Stats()
+    if len(ts.Symbols) != 0 || ts.Entropy != 0 || ts.Efficiency != 0 {
+        t.Errorf("Invalid stats for an empty tree: %+v", ts)
+    }
+
+    htree, _ = BuildHTree(strings.NewReader("zzzz"))
+    ts = htree.Stats()
+    if len(ts.Symbols) != 1 || ts.Symbols[0].CodeLength != 1 || ts.Entropy != 0 {
+        t.Errorf("Invalid stats for a single-symbol tree: %+v", ts)
+    }
+}
+
+func TestWriteDOT(t *testing.T) {
+    htree, err := BuildHTree(strings.NewReader("Hello \"World\"!\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    var buf bytes.Buffer
+    if err := htree.WriteDOT(&buf); err != nil {
+        t.Fatal(err)
+    }
+    dot := buf.String()
+
+    if !strings.HasPrefix(dot, "digraph huffman {") || !strings.HasSuffix(dot, "}\n") {
+        t.Errorf("Invalid DOT output:\n%s", dot)
+    }
+    numLeaves := strings.Count(dot, "shape=box")
+    numEdges := strings.Count(dot, "->")
+    if numLeaves != len(htree.Stats().Symbols) || numEdges != 2 * numLeaves - 2 {
+        t.Errorf("Found %d leaves and %d edges in DOT output:\n%s", numLeaves, numEdges, dot)
+    }
+    if !strings.Contains(dot, "0x22") || !strings.Contains(dot, "0x0a") || !strings.Contains(dot, "'H'") {
+        t.Errorf("Symbols are not escaped as expected:\n%s", dot)
+    }
+}
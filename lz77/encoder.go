@@ -0,0 +1,135 @@
+package lz77
+
+// Encoder turns a stream of data into tokens. It keeps the last WindowSize
+// bytes for the matches to refer to, and MaxMatch bytes of lookahead for the
+// matches to be as long as they can, which Flush gives up.
+type Encoder struct {
+    opts Options
+    finder MatchFinder
+    buf []byte
+    pos int // next position to parse
+    matches []Match
+    pending Match // match at pos-1 waiting for lazy matching, if Length > 0
+}
+
+// NewEncoder returns an encoder using 'finder', or a hash-chain match finder
+// if 'finder' is nil.
+func NewEncoder(opts Options, finder MatchFinder) (*Encoder, error) {
+    if err := opts.validate(); err != nil {
+        return nil, err
+    }
+    e := new(Encoder)
+    e.opts = opts
+    e.finder = finder
+    if e.finder == nil {
+        e.finder = NewHashChain(opts)
+    }
+    e.buf = make([]byte, 0, 2 * opts.WindowSize + opts.MaxMatch)
+    return e, nil
+}
+
+// Encode appends to 'dst' the tokens of 'data', except for the last bytes,
+// kept as lookahead until more data or Flush.
+func (e *Encoder) Encode(dst []Token, data []byte) []Token {
+    for len(data) > 0 {
+        if len(e.buf) == cap(e.buf) {
+            e.slide()
+        }
+        n := copy(e.buf[len(e.buf):cap(e.buf)], data)
+        e.buf = e.buf[:len(e.buf) + n]
+        data = data[n:]
+        dst = e.parse(dst, false)
+    }
+    return dst
+}
+
+// Flush appends to 'dst' the tokens of the lookahead. Later data can still
+// refer to the data before.
+func (e *Encoder) Flush(dst []Token) []Token {
+    return e.parse(dst, true)
+}
+
+// Reset drops all the data, as if the encoder were new.
+func (e *Encoder) Reset() {
+    e.buf = e.buf[:0]
+    e.pos = 0
+    e.pending = Match{}
+    e.finder.Reset()
+}
+
+// SetDictionary drops all the data, and makes the last WindowSize bytes of
+// 'dict' the data that the first matches can refer to.
+func (e *Encoder) SetDictionary(dict []byte) {
+    e.Reset()
+    if len(dict) > e.opts.WindowSize {
+        dict = dict[len(dict) - e.opts.WindowSize:]
+    }
+    e.buf = append(e.buf, dict...)
+    e.skip(0, len(dict))
+    e.pos = len(dict)
+}
+
+// slide drops the first WindowSize bytes of the buffer, which parse only
+// leaves full once the position is past 2*WindowSize.
+func (e *Encoder) slide() {
+    n := copy(e.buf, e.buf[e.opts.WindowSize:])
+    e.buf = e.buf[:n]
+    e.pos -= e.opts.WindowSize
+    e.finder.Slide(e.opts.WindowSize)
+}
+
+// longest returns the longest match at 'pos', inserting 'pos'.
+func (e *Encoder) longest(pos int) Match {
+    e.matches = e.finder.Matches(e.buf, pos, e.matches[:0])
+    if len(e.matches) == 0 {
+        return Match{}
+    }
+    return e.matches[len(e.matches) - 1]
+}
+
+// skip inserts the positions from 'start' to 'end', covered by a match.
+func (e *Encoder) skip(start int, end int) {
+    for pos := start ; pos < end ; pos++ {
+        e.finder.Insert(e.buf, pos)
+    }
+}
+
+// parse appends the tokens of the positions with enough lookahead, or of all
+// of them if 'flush' is set.
+func (e *Encoder) parse(dst []Token, flush bool) []Token {
+    end := len(e.buf)
+    if !flush {
+        end -= e.opts.MaxMatch
+    }
+    for e.pos < end {
+        pos := e.pos
+        m := e.longest(pos)
+
+        if e.pending.Length > 0 {
+            if m.Length > e.pending.Length {
+                // Better match one byte later
+                dst = append(dst, LiteralToken(e.buf[pos - 1]))
+                e.pending = Match{}
+            } else {
+                dst = append(dst, MatchToken(e.pending.Length, e.pending.Distance))
+                e.skip(pos + 1, pos - 1 + e.pending.Length)
+                e.pos = pos - 1 + e.pending.Length
+                e.pending = Match{}
+                continue
+            }
+        }
+
+        if m.Length < e.opts.MinMatch {
+            dst = append(dst, LiteralToken(e.buf[pos]))
+            e.pos += 1
+        } else if m.Length < e.opts.LazyLength {
+            e.pending = m
+            e.pos += 1
+        } else {
+            dst = append(dst, MatchToken(m.Length, m.Distance))
+            e.skip(pos + 1, pos + m.Length)
+            e.pos += m.Length
+        }
+    }
+    return dst
+}
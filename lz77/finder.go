@@ -0,0 +1,256 @@
+package lz77
+
+// MatchFinder finds the earlier occurrences of the data at a position of a
+// buffer. The positions are given in increasing order, and are inserted so
+// that later positions can match them. The lookahead is the data after the
+// position, up to the end of the buffer.
+type MatchFinder interface {
+    // Matches appends to 'matches' the matches of the data at 'pos', by
+    // increasing length and at most one per length, and inserts 'pos'.
+    Matches(buf []byte, pos int, matches []Match) []Match
+    // Insert inserts 'pos' without looking for matches, for the positions
+    // covered by a match.
+    Insert(buf []byte, pos int)
+    // Slide shifts all the positions by 'delta', after the buffer has
+    // dropped its first 'delta' bytes. 'delta' is a multiple of the window
+    // size.
+    Slide(delta int)
+    // Reset forgets all the positions.
+    Reset()
+}
+
+const hashBits = 16
+
+func hashAt(buf []byte, pos int, length int) uint32 {
+    var v uint32
+    for i := 0 ; i < length ; i++ {
+        v = v << 8 | uint32(buf[pos + i])
+    }
+    return v * 2654435761 >> (32 - hashBits)
+}
+
+func matchLength(buf []byte, candidate int, pos int, start int, limit int) int {
+    n := start
+    for n < limit && buf[candidate + n] == buf[pos + n] {
+        n += 1
+    }
+    return n
+}
+
+func slidePositions(positions []int32, delta int) {
+    for i, p := range positions {
+        if int(p) >= delta {
+            positions[i] = p - int32(delta)
+        } else {
+            positions[i] = -1
+        }
+    }
+}
+
+func fillPositions(positions []int32) {
+    for i := range positions {
+        positions[i] = -1
+    }
+}
+
+
+// hashChain links every position to the previous one with the same hash,
+// as zlib does, and tries the candidates from the closest one.
+type hashChain struct {
+    opts Options
+    head []int32
+    prev []int32
+    mask int
+}
+
+func NewHashChain(opts Options) MatchFinder {
+    hc := new(hashChain)
+    hc.opts = opts
+    hc.head = make([]int32, 1 << hashBits)
+    hc.prev = make([]int32, opts.WindowSize)
+    hc.mask = opts.WindowSize - 1
+    hc.Reset()
+    return hc
+}
+
+func (hc *hashChain) Reset() {
+    fillPositions(hc.head)
+    fillPositions(hc.prev)
+}
+
+func (hc *hashChain) Slide(delta int) {
+    slidePositions(hc.head, delta)
+    slidePositions(hc.prev, delta)
+}
+
+func (hc *hashChain) Insert(buf []byte, pos int) {
+    hashLen := hc.opts.hashLength()
+    if pos + hashLen > len(buf) {
+        return
+    }
+    h := hashAt(buf, pos, hashLen)
+    hc.prev[pos & hc.mask] = hc.head[h]
+    hc.head[h] = int32(pos)
+}
+
+func (hc *hashChain) Matches(buf []byte, pos int, matches []Match) []Match {
+    hashLen := hc.opts.hashLength()
+    if pos + hashLen > len(buf) {
+        return matches
+    }
+    h := hashAt(buf, pos, hashLen)
+    candidate := int(hc.head[h])
+    hc.prev[pos & hc.mask] = hc.head[h]
+    hc.head[h] = int32(pos)
+
+    limit := len(buf) - pos
+    if limit > hc.opts.MaxMatch {
+        limit = hc.opts.MaxMatch
+    }
+    if limit < hc.opts.MinMatch {
+        return matches
+    }
+    nice := hc.opts.niceLength()
+    best := hc.opts.MinMatch - 1
+    for chain := hc.opts.MaxChain ; chain > 0 && candidate >= 0 ; chain-- {
+        if pos - candidate >= hc.opts.WindowSize {
+            break
+        }
+        // The candidate can only be longer if it matches at 'best'
+        if buf[candidate + best] == buf[pos + best] {
+            n := matchLength(buf, candidate, pos, 0, limit)
+            if n > best {
+                best = n
+                matches = append(matches, Match{n, pos - candidate})
+                if n >= nice || n == limit {
+                    break
+                }
+            }
+        }
+        next := int(hc.prev[candidate & hc.mask])
+        if next >= candidate {
+            break
+        }
+        candidate = next
+    }
+    return matches
+}
+
+
+// binaryTree keeps the positions with the same hash in a binary search tree
+// ordered by the data that follows them, as the BT match finders of LZMA
+// do. Each new position becomes the root, and the search for its matches
+// splits the old tree into its two subtrees, so the tree is kept ordered
+// without any extra work. Positions with less than NiceLength bytes of
+// lookahead are only searched: they cannot be ordered properly.
+type binaryTree struct {
+    opts Options
+    head []int32
+    children []int32 // left and right children of each position
+    mask int
+}
+
+func NewBinaryTree(opts Options) MatchFinder {
+    bt := new(binaryTree)
+    bt.opts = opts
+    bt.head = make([]int32, 1 << hashBits)
+    bt.children = make([]int32, 2 * opts.WindowSize)
+    bt.mask = opts.WindowSize - 1
+    bt.Reset()
+    return bt
+}
+
+func (bt *binaryTree) Reset() {
+    fillPositions(bt.head)
+    fillPositions(bt.children)
+}
+
+func (bt *binaryTree) Slide(delta int) {
+    slidePositions(bt.head, delta)
+    slidePositions(bt.children, delta)
+}
+
+func (bt *binaryTree) Insert(buf []byte, pos int) {
+    bt.search(buf, pos, nil, false)
+}
+
+func (bt *binaryTree) Matches(buf []byte, pos int, matches []Match) []Match {
+    return bt.search(buf, pos, matches, true)
+}
+
+func (bt *binaryTree) search(buf []byte, pos int, matches []Match, record bool) []Match {
+    hashLen := bt.opts.hashLength()
+    if pos + hashLen > len(buf) {
+        return matches
+    }
+    maxLimit := len(buf) - pos
+    if maxLimit > bt.opts.MaxMatch {
+        maxLimit = bt.opts.MaxMatch
+    }
+    limit := bt.opts.niceLength()
+    update := maxLimit >= limit
+    if !update {
+        limit = maxLimit
+    }
+
+    h := hashAt(buf, pos, hashLen)
+    candidate := int(bt.head[h])
+    if update {
+        bt.head[h] = int32(pos)
+    }
+    // Where to link the next candidates smaller and larger than 'pos', and
+    // how much they have in common with it at least.
+    smaller := (pos & bt.mask) << 1
+    larger := smaller + 1
+    smallerLen, largerLen := 0, 0
+    best := bt.opts.MinMatch - 1
+
+    for chain := bt.opts.MaxChain ; ; chain-- {
+        if candidate < 0 || pos - candidate >= bt.opts.WindowSize || chain == 0 {
+            if update {
+                bt.children[smaller] = -1
+                bt.children[larger] = -1
+            }
+            return matches
+        }
+        node := (candidate & bt.mask) << 1
+        n := smallerLen
+        if largerLen < n {
+            n = largerLen
+        }
+        n = matchLength(buf, candidate, pos, n, limit)
+        if n > best {
+            best = n
+            if record {
+                length := n
+                if n == limit {
+                    length = matchLength(buf, candidate, pos, n, maxLimit)
+                }
+                matches = append(matches, Match{length, pos - candidate})
+            }
+        }
+        if n == limit {
+            // Same data as far as the tree orders it: 'pos' replaces it
+            if update {
+                bt.children[smaller] = bt.children[node]
+                bt.children[larger] = bt.children[node + 1]
+            }
+            return matches
+        }
+        if buf[candidate + n] < buf[pos + n] {
+            if update {
+                bt.children[smaller] = int32(candidate)
+                smaller = node + 1
+            }
+            smallerLen = n
+            candidate = int(bt.children[node + 1])
+        } else {
+            if update {
+                bt.children[larger] = int32(candidate)
+                larger = node
+            }
+            largerLen = n
+            candidate = int(bt.children[node])
+        }
+    }
+}
@@ -0,0 +1,85 @@
+package lz77
+
+import (
+    "math/rand"
+    "testing"
+)
+
+// longestMatch finds the longest match at 'pos' by trying every position
+func longestMatch(buf []byte, pos int, opts Options) int {
+    limit := len(buf) - pos
+    if limit > opts.MaxMatch {
+        limit = opts.MaxMatch
+    }
+    best := 0
+    for candidate := pos - 1 ; candidate >= 0 && pos - candidate < opts.WindowSize ; candidate-- {
+        if n := matchLength(buf, candidate, pos, 0, limit); n > best {
+            best = n
+        }
+    }
+    if best < opts.MinMatch {
+        return 0
+    }
+    return best
+}
+
+func TestFindersLongestMatch(t *testing.T) {
+    // Few distinct bytes, for many matches of all lengths
+    r := rand.New(rand.NewSource(4))
+    buf := make([]byte, 20000)
+    for i := range buf {
+        buf[i] = "abc"[r.Intn(3)]
+    }
+    opts := Options{WindowSize: 1024, MinMatch: 3, MaxMatch: 64, MaxChain: 1 << 20}
+
+    for name, finder := range map[string]MatchFinder{"hash chain": NewHashChain(opts), "binary tree": NewBinaryTree(opts)} {
+        var matches []Match
+        for pos := 0 ; pos < len(buf) ; pos++ {
+            // The binary tree does not insert the positions without a full
+            // lookahead, so the last ones cannot find each other
+            if name == "binary tree" && pos > len(buf) - opts.MaxMatch {
+                break
+            }
+            matches = finder.Matches(buf, pos, matches[:0])
+            longest := 0
+            for i, m := range matches {
+                if matchLength(buf, pos - m.Distance, pos, 0, m.Length) != m.Length || m.Distance >= opts.WindowSize {
+                    t.Fatalf("%s: invalid match %+v at %d", name, m, pos)
+                }
+                if i > 0 && m.Length <= matches[i - 1].Length {
+                    t.Fatalf("%s: matches are not by increasing length at %d: %+v", name, pos, matches)
+                }
+                longest = m.Length
+            }
+            if expected := longestMatch(buf, pos, opts); longest != expected {
+                t.Fatalf("%s: expected a match of %d bytes at %d, found %d", name, expected, pos, longest)
+            }
+        }
+    }
+}
+
+func TestFindersSlide(t *testing.T) {
+    r := rand.New(rand.NewSource(5))
+    buf := make([]byte, 3000)
+    for i := range buf {
+        buf[i] = "ab"[r.Intn(2)]
+    }
+    opts := Options{WindowSize: 1024, MinMatch: 3, MaxMatch: 32, MaxChain: 1 << 20}
+    for name, finder := range map[string]MatchFinder{"hash chain": NewHashChain(opts), "binary tree": NewBinaryTree(opts)} {
+        for pos := 0 ; pos < 2048 ; pos++ {
+            finder.Insert(buf, pos)
+        }
+        finder.Slide(1024)
+        slid := buf[1024:]
+        for pos := 1024 ; pos < 1500 ; pos++ {
+            matches := finder.Matches(slid, pos, nil)
+            longest := 0
+            if len(matches) > 0 {
+                longest = matches[len(matches) - 1].Length
+            }
+            if expected := longestMatch(slid, pos, opts); longest != expected {
+                t.Fatalf("%s: expected a match of %d bytes at %d, found %d", name, expected, pos, longest)
+            }
+        }
+    }
+}
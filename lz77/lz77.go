@@ -0,0 +1,133 @@
+package lz77
+
+import (
+    "errors"
+)
+
+// LZ77 turns data into a stream of tokens, each either a literal byte or a
+// match: a copy of Length bytes starting Distance bytes back in the data
+// already seen. Matches can overlap the bytes they produce, so a distance of
+// 1 repeats the last byte.
+
+var (
+    ErrInvalidOptions = errors.New("Invalid LZ77 options")
+    ErrInvalidDistance = errors.New("LZ77 match distance is beyond the data")
+    ErrInvalidLength = errors.New("LZ77 match length is out of range")
+)
+
+// Token is a literal byte if Length is 0, or a match otherwise.
+type Token struct {
+    Literal byte
+    Length int
+    Distance int
+}
+
+func LiteralToken(b byte) Token {
+    return Token{Literal: b}
+}
+
+func MatchToken(length int, distance int) Token {
+    return Token{Length: length, Distance: distance}
+}
+
+func (t Token) IsLiteral() bool {
+    return t.Length == 0
+}
+
+// Match is an earlier occurrence of the data at some position.
+type Match struct {
+    Length int
+    Distance int
+}
+
+type Options struct {
+    // WindowSize is a power of two, and matches are at most WindowSize-1
+    // bytes back.
+    WindowSize int
+    MinMatch int
+    MaxMatch int
+    // MaxChain is the number of earlier positions a match finder tries at
+    // most for each position.
+    MaxChain int
+    // NiceLength stops the search as soon as a match is this long. 0 means
+    // MaxMatch.
+    NiceLength int
+    // LazyLength enables lazy matching: a match shorter than LazyLength is
+    // only used if the next position does not have a longer one. 0 means
+    // greedy matching.
+    LazyLength int
+}
+
+// DefaultOptions fit DEFLATE, with the search effort of zlib's default
+// level.
+var DefaultOptions = Options{WindowSize: 32768, MinMatch: 3, MaxMatch: 258, MaxChain: 128, NiceLength: 128, LazyLength: 16}
+
+// LZSSOptions are those of the classic LZSS of Haruhiko Okumura: a 4 KB
+// window and matches of 3 to 18 bytes, which fit in 2 bytes.
+var LZSSOptions = Options{WindowSize: 4096, MinMatch: 3, MaxMatch: 18, MaxChain: 256}
+
+func (opts Options) validate() error {
+    if opts.WindowSize < 1 << 8 || opts.WindowSize > 1 << 24 || opts.WindowSize & (opts.WindowSize - 1) != 0 {
+        return ErrInvalidOptions
+    }
+    if opts.MinMatch < 2 || opts.MaxMatch < opts.MinMatch || opts.MaxMatch > opts.WindowSize {
+        return ErrInvalidOptions
+    }
+    if opts.MaxChain < 1 {
+        return ErrInvalidOptions
+    }
+    if opts.NiceLength != 0 && (opts.NiceLength < opts.MinMatch || opts.NiceLength > opts.MaxMatch) {
+        return ErrInvalidOptions
+    }
+    if opts.LazyLength < 0 {
+        return ErrInvalidOptions
+    }
+    return nil
+}
+
+func (opts Options) niceLength() int {
+    if opts.NiceLength == 0 {
+        return opts.MaxMatch
+    }
+    return opts.NiceLength
+}
+
+// hashLength is the number of bytes the match finders hash to find the
+// candidates for a match.
+func (opts Options) hashLength() int {
+    if opts.MinMatch > 4 {
+        return 4
+    }
+    return opts.MinMatch
+}
+
+
+// Compress returns the tokens of 'data', using a hash-chain match finder.
+func Compress(data []byte, opts Options) ([]Token, error) {
+    e, err := NewEncoder(opts, nil)
+    if err != nil {
+        return nil, err
+    }
+    tokens := e.Encode(nil, data)
+    return e.Flush(tokens), nil
+}
+
+// Expand appends to 'dst' the data of 'tokens', which can refer to the data
+// already in 'dst'.
+func Expand(dst []byte, tokens []Token) ([]byte, error) {
+    for _, t := range tokens {
+        if t.IsLiteral() {
+            dst = append(dst, t.Literal)
+            continue
+        }
+        if t.Distance < 1 || t.Distance > len(dst) {
+            return dst, ErrInvalidDistance
+        }
+        // Byte by byte, as the match can overlap what it produces
+        start := len(dst) - t.Distance
+        for i := 0 ; i < t.Length ; i++ {
+            dst = append(dst, dst[start + i])
+        }
+    }
+    return dst, nil
+}
@@ -0,0 +1,175 @@
+package lz77
+
+import (
+    "bytes"
+    "math/rand"
+    "testing"
+)
+
+func generateText(size int, seed int64) []byte {
+    words := []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur",
+                      "adipiscing", "elit", "sed", "do", "eiusmod", "tempor"}
+    r := rand.New(rand.NewSource(seed))
+    var buf bytes.Buffer
+    for buf.Len() < size {
+        buf.WriteString(words[r.Intn(len(words))])
+        if r.Intn(10) == 0 {
+            buf.WriteByte(byte(r.Intn(256)))
+        }
+        buf.WriteByte(' ')
+    }
+    return buf.Bytes()[:size]
+}
+
+func checkTokens(t *testing.T, tokens []Token, opts Options) {
+    for _, token := range tokens {
+        if !token.IsLiteral() && (token.Length < opts.MinMatch || token.Length > opts.MaxMatch || token.Distance >= opts.WindowSize) {
+            t.Fatalf("Invalid token %+v", token)
+        }
+    }
+}
+
+func TestExpand(t *testing.T) {
+    tokens := []Token{LiteralToken('a'), LiteralToken('b'), MatchToken(5, 2), MatchToken(3, 1)}
+    data, err := Expand(nil, tokens)
+    if err != nil || string(data) != "abababaaaa" {
+        t.Errorf("Expected \"abababaaaa\", found %q, %v", data, err)
+    }
+    if _, err := Expand([]byte("ab"), []Token{MatchToken(3, 3)}); err != ErrInvalidDistance {
+        t.Errorf("Expected ErrInvalidDistance, found %v", err)
+    }
+}
+
+func TestInvalidOptions(t *testing.T) {
+    optsList := []Options {
+        {},
+        {WindowSize: 1000, MinMatch: 3, MaxMatch: 258, MaxChain: 1},
+        {WindowSize: 4096, MinMatch: 1, MaxMatch: 258, MaxChain: 1},
+        {WindowSize: 4096, MinMatch: 3, MaxMatch: 2, MaxChain: 1},
+        {WindowSize: 4096, MinMatch: 3, MaxMatch: 258, MaxChain: 0},
+        {WindowSize: 4096, MinMatch: 3, MaxMatch: 258, MaxChain: 1, NiceLength: 300},
+    }
+    for _, opts := range optsList {
+        if _, err := NewEncoder(opts, nil); err != ErrInvalidOptions {
+            t.Errorf("Expected ErrInvalidOptions for %+v, found %v", opts, err)
+        }
+    }
+}
+
+func TestRoundTrip(t *testing.T) {
+    inputs := [][]byte {
+        {},
+        []byte("a"),
+        []byte("abcabcabcabcabcabcabcabc"),
+        bytes.Repeat([]byte{0}, 100000),
+        generateText(300000, 1),
+    }
+    greedy := DefaultOptions
+    greedy.LazyLength = 0
+    small := Options{WindowSize: 256, MinMatch: 4, MaxMatch: 40, MaxChain: 8}
+    for _, opts := range []Options{DefaultOptions, greedy, small, LZSSOptions} {
+        for _, newFinder := range []func(Options) MatchFinder{NewHashChain, NewBinaryTree} {
+            for _, originalData := range inputs {
+                e, err := NewEncoder(opts, newFinder(opts))
+                if err != nil {
+                    t.Fatal(err)
+                }
+                tokens := e.Flush(e.Encode(nil, originalData))
+                checkTokens(t, tokens, opts)
+                decodedData, err := Expand(nil, tokens)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if bytes.Equal(originalData, decodedData) == false {
+                    t.Errorf("Compression failed with %+v", opts)
+                }
+            }
+        }
+    }
+}
+
+func TestStreaming(t *testing.T) {
+    originalData := generateText(200000, 2)
+    for _, newFinder := range []func(Options) MatchFinder{NewHashChain, NewBinaryTree} {
+        e, _ := NewEncoder(DefaultOptions, newFinder(DefaultOptions))
+        var tokens []Token
+        // Uneven chunks, and flushes in the middle
+        for i := 0 ; i < len(originalData) ; i += 7777 {
+            end := i + 7777
+            if end > len(originalData) {
+                end = len(originalData)
+            }
+            tokens = e.Encode(tokens, originalData[i:end])
+            if i % 5 == 0 {
+                tokens = e.Flush(tokens)
+            }
+        }
+        tokens = e.Flush(tokens)
+        decodedData, err := Expand(nil, tokens)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if bytes.Equal(originalData, decodedData) == false {
+            t.Errorf("Compression failed")
+        }
+
+        // A reset encoder gives the same tokens as a new one
+        e.Reset()
+        resetTokens := e.Flush(e.Encode(nil, originalData[:50000]))
+        e, _ = NewEncoder(DefaultOptions, newFinder(DefaultOptions))
+        newTokens := e.Flush(e.Encode(nil, originalData[:50000]))
+        if len(resetTokens) != len(newTokens) {
+            t.Errorf("Found %d tokens after Reset, and %d with a new encoder", len(resetTokens), len(newTokens))
+        }
+    }
+}
+
+func TestSetDictionary(t *testing.T) {
+    dict := generateText(50000, 3)
+    data := dict[40000:45000]
+    e, _ := NewEncoder(DefaultOptions, nil)
+    e.SetDictionary(dict)
+    tokens := e.Flush(e.Encode(nil, data))
+    checkTokens(t, tokens, DefaultOptions)
+    // Data from the dictionary takes a few long matches
+    if len(tokens) > 50 {
+        t.Errorf("Expected matches of the dictionary, found %d tokens", len(tokens))
+    }
+    window := dict[len(dict) - DefaultOptions.WindowSize:]
+    decodedData, err := Expand(append([]byte{}, window...), tokens)
+    if err != nil || !bytes.Equal(decodedData[len(window):], data) {
+        t.Errorf("Compression with a dictionary failed: %v", err)
+    }
+}
+
+func TestLazyMatching(t *testing.T) {
+    // At the last 'b', "bcd" matches, but "cdef" one byte later is longer,
+    // and leaves no literals
+    data := []byte("cdef.bcd-bcdef")
+    opts := Options{WindowSize: 256, MinMatch: 3, MaxMatch: 16, MaxChain: 16}
+    tokens, _ := Compress(data, opts)
+    numGreedy := len(tokens)
+    opts.LazyLength = 16
+    tokens, _ = Compress(data, opts)
+    if len(tokens) >= numGreedy {
+        t.Errorf("Expected lazy matching to give fewer than %d tokens, found %d", numGreedy, len(tokens))
+    }
+}
+
+func BenchmarkHashChain(b *testing.B) {
+    data := generateText(1 << 20, 3)
+    b.SetBytes(int64(len(data)))
+    for i := 0 ; i < b.N ; i++ {
+        e, _ := NewEncoder(DefaultOptions, NewHashChain(DefaultOptions))
+        e.Flush(e.Encode(nil, data))
+    }
+}
+
+func BenchmarkBinaryTree(b *testing.B) {
+    data := generateText(1 << 20, 3)
+    b.SetBytes(int64(len(data)))
+    for i := 0 ; i < b.N ; i++ {
+        e, _ := NewEncoder(DefaultOptions, NewBinaryTree(DefaultOptions))
+        e.Flush(e.Encode(nil, data))
+    }
+}
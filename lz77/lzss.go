@@ -0,0 +1,214 @@
+package lz77
+
+import (
+    "bufio"
+    "errors"
+    "io"
+    "math/bits"
+)
+
+var ErrWriterClosed = errors.New("LZSS writer is closed")
+
+// lzssFormat is how matches are written: Distance-1 in the lowest
+// 'distanceBits' bits, and Length-MinMatch above, in 'matchBytes'
+// little-endian bytes.
+type lzssFormat struct {
+    distanceBits uint
+    matchBytes int
+}
+
+func newLZSSFormat(opts Options) lzssFormat {
+    var f lzssFormat
+    f.distanceBits = uint(bits.TrailingZeros(uint(opts.WindowSize)))
+    lengthBits := uint(bits.Len(uint(opts.MaxMatch - opts.MinMatch)))
+    f.matchBytes = int(f.distanceBits + lengthBits + 7) / 8
+    return f
+}
+
+// LZSSWriter writes tokens by groups of 8, each group after a flag byte
+// whose bits, from the lowest one, are 1 for a literal byte and 0 for a
+// match. There is no header: the reader must use the same options.
+type LZSSWriter struct {
+    writer io.Writer
+    opts Options
+    format lzssFormat
+    encoder *Encoder
+    tokens []Token
+    group []byte // flag byte and tokens of the current group
+    numGrouped int
+    out []byte
+    err error
+}
+
+func NewLZSSWriter(writer io.Writer, opts Options) (*LZSSWriter, error) {
+    e, err := NewEncoder(opts, nil)
+    if err != nil {
+        return nil, err
+    }
+    lw := new(LZSSWriter)
+    lw.writer = writer
+    lw.opts = opts
+    lw.format = newLZSSFormat(opts)
+    lw.encoder = e
+    lw.group = make([]byte, 1, 1 + 8 * lw.format.matchBytes)
+    return lw, nil
+}
+
+func (lw *LZSSWriter) Write(p []byte) (int, error) {
+    if lw.err != nil {
+        return 0, lw.err
+    }
+    lw.tokens = lw.encoder.Encode(lw.tokens[:0], p)
+    if lw.err = lw.writeTokens(); lw.err != nil {
+        return 0, lw.err
+    }
+    return len(p), nil
+}
+
+// Close writes the last tokens. It does not close the underlying writer.
+func (lw *LZSSWriter) Close() error {
+    if lw.err == ErrWriterClosed {
+        return nil
+    }
+    if lw.err != nil {
+        return lw.err
+    }
+    lw.tokens = lw.encoder.Flush(lw.tokens[:0])
+    if lw.err = lw.writeTokens(); lw.err != nil {
+        return lw.err
+    }
+    if lw.numGrouped > 0 {
+        lw.out = append(lw.out, lw.group...)
+    }
+    if _, lw.err = lw.writer.Write(lw.out); lw.err != nil {
+        return lw.err
+    }
+    lw.err = ErrWriterClosed
+    return nil
+}
+
+func (lw *LZSSWriter) writeTokens() error {
+    for _, t := range lw.tokens {
+        if t.IsLiteral() {
+            lw.group[0] |= 1 << uint(lw.numGrouped)
+            lw.group = append(lw.group, t.Literal)
+        } else {
+            v := uint64(t.Distance - 1) | uint64(t.Length - lw.opts.MinMatch) << lw.format.distanceBits
+            for i := 0 ; i < lw.format.matchBytes ; i++ {
+                lw.group = append(lw.group, byte(v >> uint(8 * i)))
+            }
+        }
+        lw.numGrouped += 1
+        if lw.numGrouped == 8 {
+            lw.out = append(lw.out, lw.group...)
+            lw.group = lw.group[:1]
+            lw.group[0] = 0
+            lw.numGrouped = 0
+        }
+    }
+    if len(lw.out) >= 4096 {
+        if _, err := lw.writer.Write(lw.out); err != nil {
+            return err
+        }
+        lw.out = lw.out[:0]
+    }
+    return nil
+}
+
+
+type LZSSReader struct {
+    reader io.ByteReader
+    opts Options
+    format lzssFormat
+    flags int
+    numFlags int
+    window []byte // last WindowSize bytes, and those not read yet
+    unread int // index in the window of the first byte not read yet
+    err error
+}
+
+func NewLZSSReader(reader io.Reader, opts Options) (*LZSSReader, error) {
+    if err := opts.validate(); err != nil {
+        return nil, err
+    }
+    lr := new(LZSSReader)
+    if byteReader, ok := reader.(io.ByteReader); ok {
+        lr.reader = byteReader
+    } else {
+        lr.reader = bufio.NewReader(reader)
+    }
+    lr.opts = opts
+    lr.format = newLZSSFormat(opts)
+    lr.window = make([]byte, 0, 2 * opts.WindowSize + opts.MaxMatch)
+    return lr, nil
+}
+
+func (lr *LZSSReader) Read(p []byte) (int, error) {
+    n := 0
+    for n < len(p) {
+        if lr.unread < len(lr.window) {
+            copied := copy(p[n:], lr.window[lr.unread:])
+            lr.unread += copied
+            n += copied
+            continue
+        }
+        if lr.err != nil {
+            break
+        }
+        lr.err = lr.decodeToken()
+    }
+    if n > 0 {
+        return n, nil
+    }
+    return 0, lr.err
+}
+
+// decodeToken decodes the next token at the end of the window. The data can
+// only end right before a token.
+func (lr *LZSSReader) decodeToken() error {
+    if len(lr.window) + lr.opts.MaxMatch > cap(lr.window) {
+        n := copy(lr.window, lr.window[len(lr.window) - lr.opts.WindowSize:])
+        lr.unread -= len(lr.window) - n
+        lr.window = lr.window[:n]
+    }
+    if lr.numFlags == 0 {
+        flags, err := lr.reader.ReadByte()
+        if err != nil {
+            return err
+        }
+        lr.flags = int(flags)
+        lr.numFlags = 8
+    }
+    literal := lr.flags & 1 == 1
+    lr.flags >>= 1
+    lr.numFlags -= 1
+
+    b, err := lr.reader.ReadByte()
+    if err != nil {
+        return err
+    }
+    if literal {
+        lr.window = append(lr.window, b)
+        return nil
+    }
+    v := uint64(b)
+    for i := 1 ; i < lr.format.matchBytes ; i++ {
+        if b, err = lr.reader.ReadByte(); err != nil {
+            return io.ErrUnexpectedEOF
+        }
+        v |= uint64(b) << uint(8 * i)
+    }
+    distance := int(v & (1 << lr.format.distanceBits - 1)) + 1
+    length := int(v >> lr.format.distanceBits) + lr.opts.MinMatch
+    if distance > len(lr.window) {
+        return ErrInvalidDistance
+    }
+    if length > lr.opts.MaxMatch {
+        return ErrInvalidLength
+    }
+    start := len(lr.window) - distance
+    for i := 0 ; i < length ; i++ {
+        lr.window = append(lr.window, lr.window[start + i])
+    }
+    return nil
+}
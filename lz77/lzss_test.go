@@ -0,0 +1,74 @@
+package lz77
+
+import (
+    "bytes"
+    "io"
+    "io/ioutil"
+    "testing"
+    "testing/iotest"
+)
+
+func TestLZSSRoundTrip(t *testing.T) {
+    originalData := generateText(300000, 6)
+    wide := Options{WindowSize: 1 << 16, MinMatch: 4, MaxMatch: 1000, MaxChain: 64, LazyLength: 32}
+    for _, opts := range []Options{LZSSOptions, wide} {
+        var buf bytes.Buffer
+        lw, err := NewLZSSWriter(&buf, opts)
+        if err != nil {
+            t.Fatal(err)
+        }
+        for i := 0 ; i < len(originalData) ; i += 10000 {
+            lw.Write(originalData[i:i + 10000])
+        }
+        if err := lw.Close(); err != nil {
+            t.Fatal(err)
+        }
+        if buf.Len() >= len(originalData) / 2 {
+            t.Errorf("Expected better compression, found %d bytes for %d", buf.Len(), len(originalData))
+        }
+
+        lr, err := NewLZSSReader(iotest.HalfReader(bytes.NewReader(buf.Bytes())), opts)
+        if err != nil {
+            t.Fatal(err)
+        }
+        decodedData, err := ioutil.ReadAll(iotest.OneByteReader(lr))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if bytes.Equal(originalData, decodedData) == false {
+            t.Errorf("Compression failed with %+v", opts)
+        }
+    }
+}
+
+func TestLZSSFormat(t *testing.T) {
+    // Three literals, then a match of 6 bytes 3 bytes back: 0x002 | 3 << 12
+    var buf bytes.Buffer
+    lw, _ := NewLZSSWriter(&buf, LZSSOptions)
+    lw.Write([]byte("abcabcabc"))
+    lw.Close()
+    expected := []byte{0x07, 'a', 'b', 'c', 0x02, 0x30}
+    if bytes.Equal(buf.Bytes(), expected) == false {
+        t.Errorf("Expected %x, found %x", expected, buf.Bytes())
+    }
+}
+
+func TestLZSSInvalid(t *testing.T) {
+    tests := []struct {
+        data []byte
+        err error
+    } {
+        {[]byte{0x00, 0x02, 0x30}, ErrInvalidDistance},
+        {[]byte{0x01, 'a', 0x00, 0x30}, nil},
+        {[]byte{0x01, 'a', 0x00}, io.ErrUnexpectedEOF},
+        {[]byte{0x01, 'a', 0x00, 0xf0}, ErrInvalidLength},
+    }
+    opts := LZSSOptions
+    opts.MaxMatch = 17
+    for _, test := range tests {
+        lr, _ := NewLZSSReader(bytes.NewReader(test.data), opts)
+        if _, err := ioutil.ReadAll(lr); err != test.err {
+            t.Errorf("Expected %v for %x, found %v", test.err, test.data, err)
+        }
+    }
+}
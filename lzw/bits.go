@@ -0,0 +1,155 @@
+package lzw
+
+import (
+    "io"
+)
+
+// Codes are packed least-significant bit first, as in compress(1) and GIF,
+// where the first code starts at the lowest bit of the first byte, or
+// most-significant bit first, as in TIFF.
+
+type bitWriter struct {
+    writer io.Writer
+    order Order
+    buf []byte
+    bits uint64
+    nbits uint
+    numBitsWritten int
+    groupBits uint
+}
+
+func newBitWriter(writer io.Writer, order Order) *bitWriter {
+    bw := new(bitWriter)
+    bw.writer = writer
+    bw.order = order
+    bw.buf = make([]byte, 0, 4096)
+    return bw
+}
+
+func (bw *bitWriter) WriteBits(code int, width uint) error {
+    bw.numBitsWritten += int(width)
+    bw.groupBits += width
+    if bw.order == MSB {
+        bw.bits |= uint64(code) << (64 - bw.nbits - width)
+        bw.nbits += width
+        for bw.nbits >= 8 {
+            bw.buf = append(bw.buf, byte(bw.bits >> 56))
+            bw.bits <<= 8
+            bw.nbits -= 8
+        }
+    } else {
+        bw.bits |= uint64(code) << bw.nbits
+        bw.nbits += width
+        for bw.nbits >= 8 {
+            bw.buf = append(bw.buf, byte(bw.bits))
+            bw.bits >>= 8
+            bw.nbits -= 8
+        }
+    }
+    if len(bw.buf) >= cap(bw.buf) - 8 {
+        return bw.writeBuffer()
+    }
+    return nil
+}
+
+func (bw *bitWriter) writeBuffer() error {
+    if _, err := bw.writer.Write(bw.buf); err != nil {
+        return err
+    }
+    bw.buf = bw.buf[:0]
+    return nil
+}
+
+// PadGroup writes zeros up to the end of the current group of 8 codes of
+// 'width' bits. compress(1) writes its codes by groups of 8, and pads the
+// current group when the code width changes or after a CLEAR code.
+func (bw *bitWriter) PadGroup(width uint) error {
+    padBits := (width * 8 - bw.groupBits % (width * 8)) % (width * 8)
+    for padBits > 0 {
+        step := padBits
+        if step > 32 {
+            step = 32
+        }
+        if err := bw.WriteBits(0, step); err != nil {
+            return err
+        }
+        padBits -= step
+    }
+    bw.groupBits = 0
+    return nil
+}
+
+// Flush pads the last byte with zeros and writes out everything.
+func (bw *bitWriter) Flush() error {
+    if bw.nbits > 0 {
+        if bw.order == MSB {
+            bw.buf = append(bw.buf, byte(bw.bits >> 56))
+        } else {
+            bw.buf = append(bw.buf, byte(bw.bits))
+        }
+        bw.bits = 0
+        bw.nbits = 0
+    }
+    return bw.writeBuffer()
+}
+
+
+type bitReader struct {
+    reader io.ByteReader
+    order Order
+    bits uint64
+    nbits uint
+    groupBits uint
+}
+
+func newBitReader(reader io.ByteReader, order Order) *bitReader {
+    br := new(bitReader)
+    br.reader = reader
+    br.order = order
+    return br
+}
+
+// ReadBits returns io.EOF when fewer than 'width' bits are left, as they can
+// only be the padding of the last byte.
+func (br *bitReader) ReadBits(width uint) (int, error) {
+    for br.nbits < width {
+        b, err := br.reader.ReadByte()
+        if err != nil {
+            return 0, err
+        }
+        if br.order == MSB {
+            br.bits |= uint64(b) << (56 - br.nbits)
+        } else {
+            br.bits |= uint64(b) << br.nbits
+        }
+        br.nbits += 8
+    }
+    var code int
+    if br.order == MSB {
+        code = int(br.bits >> (64 - width))
+        br.bits <<= width
+    } else {
+        code = int(br.bits & (1 << width - 1))
+        br.bits >>= width
+    }
+    br.nbits -= width
+    br.groupBits += width
+    return code, nil
+}
+
+// SkipGroup skips the padding written by bitWriter.PadGroup().
+func (br *bitReader) SkipGroup(width uint) error {
+    padBits := (width * 8 - br.groupBits % (width * 8)) % (width * 8)
+    for padBits > 0 {
+        step := padBits
+        if step > 32 {
+            step = 32
+        }
+        if _, err := br.ReadBits(step); err != nil {
+            return err
+        }
+        padBits -= step
+    }
+    br.groupBits = 0
+    return nil
+}
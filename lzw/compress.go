@@ -0,0 +1,67 @@
+package lzw
+
+import (
+    "bytes"
+    "errors"
+    "io"
+)
+
+// Unix compress(1) file format (.Z)
+//
+// A 3-byte header holds the magic number 0x1f 0x9d, then a byte with the
+// maximum code width in its low 5 bits and the "block mode" flag in its high
+// bit. In block mode, code 256 is the CLEAR code, sent when the compression
+// ratio declines once the dictionary is full. The codes follow, with the
+// group padding of compress(1).
+const (
+    ZMagic1 = 0x1f
+    ZMagic2 = 0x9d
+    ZMaxBitsMask = 0x1f
+    ZReservedMask = 0x60
+    ZBlockMode = 0x80
+)
+
+var ErrInvalidZHeader = errors.New("Invalid .Z header")
+
+// ZOptions returns the options matching the .Z format with block mode on or
+// off, which is what the header byte of a .Z file describes.
+func ZOptions(maxBits int, blockMode bool) Options {
+    opts := Options{MaxBits: maxBits, Full: FullFreeze, AlignGroups: true}
+    if blockMode {
+        opts.Full = FullAdaptiveReset
+    }
+    return opts
+}
+
+// CompressZ compresses 'rawData' into a .Z file in block mode, like
+// 'compress -b maxBits' would.
+func CompressZ(rawData io.Reader, maxBits int) (compressedData *[]byte, err error) {
+    compressed, _, err := CompressWithOptions(rawData, ZOptions(maxBits, true))
+    if err != nil {
+        return nil, err
+    }
+    out := make([]byte, 0, 3 + len(*compressed))
+    out = append(out, ZMagic1, ZMagic2, byte(maxBits) | ZBlockMode)
+    out = append(out, *compressed...)
+    return &out, nil
+}
+
+func UncompressZ(compressedData io.Reader) (uncompressedData *[]byte, err error) {
+    header := make([]byte, 3)
+    if _, err := io.ReadFull(compressedData, header); err != nil {
+        return nil, ErrInvalidZHeader
+    }
+    if header[0] != ZMagic1 || header[1] != ZMagic2 || header[2] & ZReservedMask != 0 {
+        return nil, ErrInvalidZHeader
+    }
+    maxBits := int(header[2] & ZMaxBitsMask)
+    if maxBits < MinBits || maxBits > MaxMaxBits {
+        return nil, ErrInvalidZHeader
+    }
+    return UncompressWithOptions(compressedData, ZOptions(maxBits, header[2] & ZBlockMode != 0))
+}
+
+// IsZ tells whether 'data' starts with the .Z magic number.
+func IsZ(data []byte) bool {
+    return bytes.HasPrefix(data, []byte{ZMagic1, ZMagic2})
+}
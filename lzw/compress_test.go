@@ -0,0 +1,108 @@
+package lzw
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+// .Z file of "TOBEORNOTTOBEORTOBEORNOT#", as decoded by 'gzip -d'
+var tobeornotZ = []byte{0x1f, 0x9d, 0x90, 0x54, 0x9e, 0x08, 0x29, 0xf2, 0x44, 0x8a,
+                        0x93, 0x27, 0x54, 0x02, 0x0e, 0x2c, 0xa8, 0x90, 0xa0, 0x41,
+                        0x84, 0x23, 0x00}
+
+func TestZKnownFile(t *testing.T) {
+    originalData := "TOBEORNOTTOBEORTOBEORNOT#"
+
+    encodedData, err := CompressZ(strings.NewReader(originalData), 16)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if bytes.Equal(tobeornotZ, *encodedData) == false {
+        t.Errorf("Compressed data does not match the .Z file:\n%x\n%x", tobeornotZ, *encodedData)
+    }
+
+    decodedData, err := UncompressZ(bytes.NewReader(tobeornotZ))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(*decodedData) != originalData {
+        t.Errorf("Compression failed")
+    }
+}
+
+func TestZRoundTrip(t *testing.T) {
+    // Text, then noise to make the compression ratio decline and trigger
+    // CLEAR codes, then text again.
+    originalData := generateText(300000, 2)
+    noise := generateText(100000, 3)
+    for i := range noise {
+        noise[i] ^= byte(i * 7919)
+    }
+    originalData = append(originalData, noise...)
+    originalData = append(originalData, generateText(100000, 4)...)
+
+    for _, maxBits := range []int{9, 10, 12, 16} {
+        encodedData, err := CompressZ(bytes.NewReader(originalData), maxBits)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !IsZ(*encodedData) || (*encodedData)[2] != byte(maxBits) | ZBlockMode {
+            t.Errorf("Invalid .Z header %x", (*encodedData)[:3])
+        }
+        decodedData, err := UncompressZ(bytes.NewReader(*encodedData))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if bytes.Equal(originalData, *decodedData) == false {
+            t.Errorf("Compression failed with %d bits", maxBits)
+        }
+    }
+}
+
+func TestZNoBlockMode(t *testing.T) {
+    // Without block mode, code 256 is a regular code and there is no CLEAR
+    originalData := generateText(200000, 5)
+    encodedData, _, err := CompressWithOptions(bytes.NewReader(originalData), ZOptions(12, false))
+    if err != nil {
+        t.Fatal(err)
+    }
+    file := append([]byte{ZMagic1, ZMagic2, 12}, *encodedData...)
+    decodedData, err := UncompressZ(bytes.NewReader(file))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if bytes.Equal(originalData, *decodedData) == false {
+        t.Errorf("Compression failed")
+    }
+}
+
+func TestZEmpty(t *testing.T) {
+    // Only the header, as compress(1) writes for an empty file
+    encodedData, err := CompressZ(strings.NewReader(""), 16)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if bytes.Equal(*encodedData, []byte{ZMagic1, ZMagic2, 16 | ZBlockMode}) == false {
+        t.Errorf("Expected a lone header, found %x", *encodedData)
+    }
+    decodedData, err := UncompressZ(bytes.NewReader(*encodedData))
+    if err != nil || len(*decodedData) != 0 {
+        t.Errorf("Expected no data, found %v, %v", decodedData, err)
+    }
+}
+
+func TestZInvalidHeader(t *testing.T) {
+    headers := [][]byte {
+        {},
+        {0x1f, 0x8b, 0x90},
+        {0x1f, 0x9d, 0x88},
+        {0x1f, 0x9d, 0x91},
+        {0x1f, 0x9d, 0xf0},
+    }
+    for _, header := range headers {
+        if _, err := UncompressZ(bytes.NewReader(header)); err != ErrInvalidZHeader {
+            t.Errorf("Expected ErrInvalidZHeader for %x, found %v", header, err)
+        }
+    }
+}
@@ -2,105 +2,236 @@ package lzw
 
 import (
     "io"
-    "strings"
-    "encoding/binary"
+    "io/ioutil"
+    "bytes"
+    "errors"
+)
+
+// Codes start one bit wider than the literals, so 9 bits wide for bytes,
+// and grow by one bit every time the dictionary gets an entry that does not
+// fit in the current width, up to MaxBits.
+const (
+    MinBits = 9
+    MaxMaxBits = 16
+    ClearCode = 256
+)
+
+// FullPolicy tells what to do once the dictionary has 2^MaxBits entries.
+type FullPolicy int
+
+const (
+    // FullFreeze stops adding entries, and keeps encoding with the
+    // dictionary as it is.
+    FullFreeze FullPolicy = iota
+    // FullReset emits the CLEAR code (256) and starts over with an empty
+    // dictionary and 9-bit codes.
+    FullReset
+    // FullAdaptiveReset keeps the full dictionary as long as the compression
+    // ratio improves, checking it every 10000 input bytes like compress(1),
+    // and emits the CLEAR code once it declines.
+    FullAdaptiveReset
+)
+
+const adaptiveResetCheckGap = 10000
+
+// Order is the order in which the bits of the codes are packed into bytes.
+type Order int
 
-    "github.com/goossaert/compression/logging"
+const (
+    // LSB packs codes starting from the least-significant bit, as in .Z and
+    // GIF files.
+    LSB Order = iota
+    // MSB packs codes starting from the most-significant bit, as in TIFF
+    // and PDF files.
+    MSB
 )
 
-// TODO profile memory allocations
-// TODO code duplication in the flush part of Compress()
-// TODO use varints instead of uint16
+// Growth is the way the dictionary grows after each code.
+type Growth int
+
+const (
+    // GrowthLZW adds the previous match followed by the first byte of the
+    // current one.
+    GrowthLZW Growth = iota
+    // GrowthLZMW adds the previous match followed by the whole current one,
+    // so that entries grow much faster on repetitive data.
+    GrowthLZMW
+    // GrowthLZAP adds the previous match followed by every prefix of the
+    // current one, one entry each.
+    GrowthLZAP
+)
+
+type Options struct {
+    Order Order
+    // LitWidth is the number of bits of the literals, 8 if left to 0. GIF
+    // calls it the minimum code size, and allows 2 to 8 bits. The input
+    // bytes must all be below 2^LitWidth.
+    LitWidth int
+    MaxBits int
+    Full FullPolicy
+    // AlignGroups pads the codes to a multiple of 8 codes when the code
+    // width changes and after a CLEAR code, as compress(1) does.
+    AlignGroups bool
+    // EarlyChange widens the codes one code earlier than needed, as TIFF
+    // does.
+    EarlyChange bool
+    // EOICode reserves the code after CLEAR for the end of the data. The
+    // encoder then starts with a CLEAR code and ends with the EOI code, as
+    // GIF and TIFF require, and the decoder stops at the EOI code.
+    EOICode bool
+    // Growth selects LZMW or LZAP instead of LZW. These variants add their
+    // entries only after the current code, and widen the codes as soon as
+    // the last entry does not fit, which is not compatible with EarlyChange.
+    Growth Growth
+}
+
+// DefaultOptions gives self-terminating streams, with codes of up to 16 bits.
+var DefaultOptions = Options{MaxBits: 16, Full: FullReset, EOICode: true}
+
+// GIFOptions returns the options of the LZW variant of GIF images, for a
+// given minimum code size.
+func GIFOptions(litWidth int) Options {
+    return Options{Order: LSB, LitWidth: litWidth, MaxBits: 12, Full: FullReset, EOICode: true}
+}
+
+// TIFFOptions returns the options of the LZW variant of TIFF images.
+func TIFFOptions() Options {
+    return Options{Order: MSB, LitWidth: 8, MaxBits: 12, Full: FullReset, EarlyChange: true, EOICode: true}
+}
+
+var ErrInvalidOptions = errors.New("Invalid LZW options")
+
+func (opts Options) validate() error {
+    if opts.Order != LSB && opts.Order != MSB {
+        return ErrInvalidOptions
+    }
+    if opts.LitWidth != 0 && (opts.LitWidth < 2 || opts.LitWidth > 8) {
+        return ErrInvalidOptions
+    }
+    if opts.MaxBits <= opts.litWidth() || opts.MaxBits > MaxMaxBits {
+        return ErrInvalidOptions
+    }
+    if opts.Full != FullFreeze && opts.Full != FullReset && opts.Full != FullAdaptiveReset {
+        return ErrInvalidOptions
+    }
+    if opts.Growth != GrowthLZW && opts.Growth != GrowthLZMW && opts.Growth != GrowthLZAP {
+        return ErrInvalidOptions
+    }
+    if opts.Growth != GrowthLZW && opts.EarlyChange {
+        return ErrInvalidOptions
+    }
+    return nil
+}
+
+func (opts Options) litWidth() int {
+    if opts.LitWidth == 0 {
+        return 8
+    }
+    return opts.LitWidth
+}
+
+func (opts Options) hasClearCode() bool {
+    return opts.Full == FullReset || opts.Full == FullAdaptiveReset || opts.EOICode
+}
 
+func (opts Options) clearCode() int {
+    return 1 << uint(opts.litWidth())
+}
+
+func (opts Options) eoiCode() int {
+    return opts.clearCode() + 1
+}
+
+func (opts Options) minWidth() uint {
+    return uint(opts.litWidth()) + 1
+}
+
+// maxWidth is the largest code width. compress(1) checks for the last width
+// only after widening, so with a maximum of 9 bits it still goes up to
+// 10-bit codes once the dictionary is full.
+func (opts Options) maxWidth() uint {
+    if opts.AlignGroups && opts.MaxBits == MinBits {
+        return MinBits + 1
+    }
+    return uint(opts.MaxBits)
+}
+
+// firstCode is the first code available for new entries, right after the
+// literals and the CLEAR and EOI codes if there are any.
+func (opts Options) firstCode() int {
+    if opts.EOICode {
+        return opts.eoiCode() + 1
+    }
+    if opts.hasClearCode() {
+        return opts.clearCode() + 1
+    }
+    return opts.clearCode()
+}
+
+// widens tells whether the code width must grow, 'nextCode' being the code
+// of the entry about to be added.
+func (opts Options) widens(nextCode int, width uint) bool {
+    if width >= opts.maxWidth() {
+        return false
+    }
+    if opts.EarlyChange {
+        return nextCode + 1 == 1 << width
+    }
+    return nextCode == 1 << width
+}
+
+// variantWidens tells whether the code width must grow for LZMW and LZAP,
+// 'nextCode' being the code of the next entry. As the next code read never
+// refers to an entry that does not exist yet, the codes only have to fit the
+// last entry.
+func (opts Options) variantWidens(nextCode int, width uint) bool {
+    return width < opts.maxWidth() && nextCode > 1 << width
+}
+
+
+// Compress compresses 'rawData' with DefaultOptions. The returned number of
+// bits is only informative: the stream ends with an EOI code, so it is not
+// needed to uncompress.
 func Compress(rawData io.Reader) (compressedData *[]byte, nbits int) {
-    var out []byte
-    logging.Trace.Printf("Compress()\n")
-    stringsToCodes := make(map[string]uint16)
-    for i := 0 ; i < 256 ; i++ {
-        stringsToCodes[string(i)] = uint16(i)
-    }
-    var nextCode uint16 = 256
-
-    readBuffer := make([]byte, 1024)
-    outputBytes := make([]byte, 2)
-    nbits = 0
-    var window []byte
-    for {
-        n, err := rawData.Read(readBuffer)
-        if err == io.EOF {
-            // Flush out the last string to encode
-            outputCode := stringsToCodes[string(window[:])]
-            logging.Trace.Printf("ENC %s => %d\n", string(window[:]), outputCode)
-            binary.LittleEndian.PutUint16(outputBytes, outputCode)
-            out = append(out, outputBytes...)
-            nbits += 16
-            break
-        }
-        logging.Trace.Printf("nbytes read: %d\n", n)
-        for i := 0 ; i < n ; i++ {
-            window = append(window, readBuffer[i])
-            if _, ok := stringsToCodes[string(window[:])]; ok {
-                continue
-            }
-
-            stringsToCodes[string(window[:])] = nextCode
-            logging.Trace.Printf("ADD %s => %d\n", string(window[:]), nextCode)
-            nextCode += 1
-            outputCode := stringsToCodes[string(window[:len(window)-1])]
-            logging.Trace.Printf("ENC %s => %d\n", string(window[:len(window)-1]), outputCode)
-            binary.LittleEndian.PutUint16(outputBytes, outputCode)
-            out = append(out, outputBytes...)
-            nbits += 16
-
-            window = window[:1]
-            window[0] = readBuffer[i]
-        }
-    }
-
-    return &out, nbits
+    compressedData, nbits, _ = CompressWithOptions(rawData, DefaultOptions)
+    return compressedData, nbits
 }
 
 
+func CompressWithOptions(rawData io.Reader, opts Options) (compressedData *[]byte, nbits int, err error) {
+    var out bytes.Buffer
+    lw, err := NewWriterOptions(&out, opts)
+    if err != nil {
+        return nil, 0, err
+    }
+    if _, err := io.Copy(lw, rawData); err != nil {
+        return nil, 0, err
+    }
+    if err := lw.Close(); err != nil {
+        return nil, 0, err
+    }
+    compressed := out.Bytes()
+    return &compressed, lw.bw.numBitsWritten, nil
+}
+
+
+// Uncompress uncompresses data written by Compress. 'nbits' is ignored, and
+// only kept for compatibility. It returns nil if the data is malformed or
+// truncated, UncompressWithOptions tells why.
 func Uncompress(compressedData io.Reader, nbits int) (uncompressedData *[]byte) {
-    var out []byte
-    logging.Trace.Printf("Uncompress()\n")
-    codesToStrings := make(map[uint16]string)
-    for i := 0 ; i < 256 ; i++ {
-        codesToStrings[uint16(i)] = string(i)
-    }
-    var nextCode uint16 = 256
-
-    var stringBuilder strings.Builder
-    readBuffer := make([]byte, 1024)
-    var previousString string
-
-    for {
-        n, err := compressedData.Read(readBuffer)
-        if err == io.EOF {
-            break
-        }
-        for i := 0 ; i < n ; i += 2 {
-            var code uint16 = binary.LittleEndian.Uint16(readBuffer[i:i+2])
-            if _, ok := codesToStrings[code] ; !ok {
-                stringBuilder.Reset()
-                stringBuilder.WriteString(previousString)
-                stringBuilder.WriteByte(previousString[0])
-                codesToStrings[code] = stringBuilder.String()
-                logging.Trace.Printf("ADDN %s => %d\n", stringBuilder.String(), code)
-            }
-            out = append(out, codesToStrings[code]...)
-            logging.Trace.Printf("DEC %d => %s\n", code, codesToStrings[code])
-            if len(previousString) > 0 {
-                stringBuilder.Reset()
-                stringBuilder.WriteString(previousString)
-                stringBuilder.WriteByte(codesToStrings[code][0])
-                codesToStrings[nextCode] = stringBuilder.String()
-                logging.Trace.Printf("ADD %s => %d\n", stringBuilder.String(), nextCode)
-                nextCode += 1
-            }
-            previousString = codesToStrings[code]
-        }
-    }
-    return &out
+    uncompressedData, _ = UncompressWithOptions(compressedData, DefaultOptions)
+    return uncompressedData
 }
 
+
+func UncompressWithOptions(compressedData io.Reader, opts Options) (uncompressedData *[]byte, err error) {
+    lr, err := NewReaderOptions(compressedData, opts)
+    if err != nil {
+        return nil, err
+    }
+    out, err := ioutil.ReadAll(lr)
+    if err != nil {
+        return nil, err
+    }
+    return &out, nil
+}
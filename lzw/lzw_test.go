@@ -3,7 +3,11 @@ package lzw
 import (
     "strings"
     "bytes"
+    "io"
+    "io/ioutil"
+    "math/rand"
     "testing"
+    stdlzw "compress/lzw"
 )
 
 func TestSingleString(t *testing.T) {
@@ -28,13 +32,234 @@ func TestSingleString(t *testing.T) {
 }
 
 func BenchmarkString(b *testing.B) {
-    originalData := "Hello World! I really like to say Hello to this World!"
+    inputs := []struct {
+        name string
+        data []byte
+    }{
+        {"Hello", []byte("Hello World! I really like to say Hello to this World!")},
+        {"Text64K", generateText(1 << 16, 12)},
+        {"Text1M", generateText(1 << 20, 12)},
+    }
+    for _, input := range inputs {
+        originalData := input.data
+        b.Run(input.name + "/Compress", func(b *testing.B) {
+            b.ReportAllocs()
+            b.SetBytes(int64(len(originalData)))
+            for i := 0 ; i < b.N ; i++ {
+                Compress(bytes.NewReader(originalData))
+            }
+        })
+        b.Run(input.name + "/Uncompress", func(b *testing.B) {
+            encodedData, nbits := Compress(bytes.NewReader(originalData))
+            b.ReportAllocs()
+            b.SetBytes(int64(len(originalData)))
+            b.ResetTimer()
+            for i := 0 ; i < b.N ; i++ {
+                Uncompress(bytes.NewReader(*encodedData), nbits)
+            }
+        })
+    }
+}
 
-    for i := 0 ; i < b.N ; i++ {
-        r := strings.NewReader(originalData)
-        encodedData, nbits := Compress(r)
+func generateText(size int, seed int64) []byte {
+    words := []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur",
+                      "adipiscing", "elit", "sed", "do", "eiusmod", "tempor"}
+    r := rand.New(rand.NewSource(seed))
+    var buf bytes.Buffer
+    for buf.Len() < size {
+        buf.WriteString(words[r.Intn(len(words))])
+        if r.Intn(10) == 0 {
+            // Some noise so that the dictionary keeps growing
+            buf.WriteByte(byte(r.Intn(256)))
+        }
+        buf.WriteByte(' ')
+    }
+    return buf.Bytes()[:size]
+}
 
-        r2 := bytes.NewReader(*encodedData)
-        Uncompress(r2, nbits)
+func TestVariableWidth(t *testing.T) {
+    originalData := generateText(1 << 20, 1)
+
+    for _, maxBits := range []int{9, 12, 16} {
+        for _, full := range []FullPolicy{FullFreeze, FullReset} {
+            opts := Options{MaxBits: maxBits, Full: full}
+            encodedData, nbits, err := CompressWithOptions(bytes.NewReader(originalData), opts)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if (nbits + 7) / 8 != len(*encodedData) {
+                t.Errorf("Found %d bits for %d bytes", nbits, len(*encodedData))
+            }
+
+            decodedData, err := UncompressWithOptions(bytes.NewReader(*encodedData), opts)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if bytes.Equal(originalData, *decodedData) == false {
+                t.Errorf("Compression failed with MaxBits %d and policy %d", maxBits, full)
+            }
+        }
+    }
+}
+
+func TestVariableWidthSmallInput(t *testing.T) {
+    // With 9-bit codes, 4 codes take 36 bits
+    opts := Options{MaxBits: 16, Full: FullReset}
+    encodedData, nbits, err := CompressWithOptions(strings.NewReader("abcd"), opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if nbits != 36 || len(*encodedData) != 5 {
+        t.Errorf("Expected 36 bits in 5 bytes, found %d bits in %d bytes", nbits, len(*encodedData))
+    }
+}
+
+func TestEmptyInput(t *testing.T) {
+    // Only CLEAR and EOI, 18 bits
+    encodedData, nbits := Compress(strings.NewReader(""))
+    if nbits != 18 || len(*encodedData) != 3 {
+        t.Errorf("Expected 18 bits in 3 bytes, found %d bits in %d bytes", nbits, len(*encodedData))
+    }
+    decodedData := Uncompress(bytes.NewReader(*encodedData), nbits)
+    if decodedData == nil || len(*decodedData) != 0 {
+        t.Errorf("Expected no data, found %v", decodedData)
+    }
+
+    // No code at all without EOI
+    opts := Options{MaxBits: 12}
+    encodedData, nbits, err := CompressWithOptions(strings.NewReader(""), opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if nbits != 0 || len(*encodedData) != 0 {
+        t.Errorf("Expected no data, found %d bits in %d bytes", nbits, len(*encodedData))
+    }
+    decodedData, err = UncompressWithOptions(bytes.NewReader(nil), opts)
+    if err != nil || len(*decodedData) != 0 {
+        t.Errorf("Expected no data, found %v, %v", decodedData, err)
+    }
+
+    if _, err := UncompressWithOptions(bytes.NewReader(nil), DefaultOptions); err != io.ErrUnexpectedEOF {
+        t.Errorf("Expected io.ErrUnexpectedEOF, found %v", err)
+    }
+}
+
+func TestInvalidOptions(t *testing.T) {
+    for _, opts := range []Options{{MaxBits: 8}, {MaxBits: 17}, {MaxBits: 12, Full: 5}} {
+        if _, _, err := CompressWithOptions(strings.NewReader("abc"), opts); err != ErrInvalidOptions {
+            t.Errorf("Expected ErrInvalidOptions for %+v, found %v", opts, err)
+        }
+    }
+}
+
+func TestGIFCompatibility(t *testing.T) {
+    for _, litWidth := range []int{2, 4, 8} {
+        originalData := generateText(200000, 6)
+        for i := range originalData {
+            originalData[i] &= byte(1 << uint(litWidth) - 1)
+        }
+
+        // Our encoder, standard library decoder
+        encodedData, _, err := CompressWithOptions(bytes.NewReader(originalData), GIFOptions(litWidth))
+        if err != nil {
+            t.Fatal(err)
+        }
+        decodedData, err := ioutil.ReadAll(stdlzw.NewReader(bytes.NewReader(*encodedData), stdlzw.LSB, litWidth))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if bytes.Equal(originalData, decodedData) == false {
+            t.Errorf("Standard library failed to decode GIF data with literal width %d", litWidth)
+        }
+
+        // Standard library encoder, our decoder
+        var buf bytes.Buffer
+        w := stdlzw.NewWriter(&buf, stdlzw.LSB, litWidth)
+        w.Write(originalData)
+        w.Close()
+        decoded, err := UncompressWithOptions(bytes.NewReader(buf.Bytes()), GIFOptions(litWidth))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if bytes.Equal(originalData, *decoded) == false {
+            t.Errorf("Failed to decode GIF data with literal width %d", litWidth)
+        }
+    }
+
+    if _, _, err := CompressWithOptions(strings.NewReader("abc"), GIFOptions(4)); err != ErrInvalidLiteral {
+        t.Errorf("Expected ErrInvalidLiteral, found %v", err)
+    }
+}
+
+func TestMSBCompatibility(t *testing.T) {
+    originalData := generateText(200000, 7)
+    opts := Options{Order: MSB, MaxBits: 12, Full: FullReset, EOICode: true}
+
+    encodedData, _, err := CompressWithOptions(bytes.NewReader(originalData), opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    decodedData, err := ioutil.ReadAll(stdlzw.NewReader(bytes.NewReader(*encodedData), stdlzw.MSB, 8))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if bytes.Equal(originalData, decodedData) == false {
+        t.Errorf("Standard library failed to decode MSB data")
+    }
+}
+
+func TestTIFFEarlyChange(t *testing.T) {
+    // Random bytes give about one code per byte, so the codes widen to 10
+    // bits within the first 400 codes, and not to 11 bits.
+    r := rand.New(rand.NewSource(8))
+    originalData := make([]byte, 400)
+    r.Read(originalData)
+
+    normal := TIFFOptions()
+    normal.EarlyChange = false
+    _, nbitsNormal, err := CompressWithOptions(bytes.NewReader(originalData), normal)
+    if err != nil {
+        t.Fatal(err)
+    }
+    encodedData, nbitsEarly, err := CompressWithOptions(bytes.NewReader(originalData), TIFFOptions())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if nbitsEarly != nbitsNormal + 1 {
+        t.Errorf("Expected early change to widen one code earlier, found %d and %d bits", nbitsEarly, nbitsNormal)
+    }
+
+    // First code is CLEAR (256), most-significant bit first
+    if (*encodedData)[0] != 0x80 || (*encodedData)[1] & 0x80 != 0 {
+        t.Errorf("Expected a CLEAR code first, found %x", (*encodedData)[:2])
+    }
+
+    originalData = generateText(200000, 9)
+    encodedData, _, err = CompressWithOptions(bytes.NewReader(originalData), TIFFOptions())
+    if err != nil {
+        t.Fatal(err)
+    }
+    decodedData, err := UncompressWithOptions(bytes.NewReader(*encodedData), TIFFOptions())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if bytes.Equal(originalData, *decodedData) == false {
+        t.Errorf("Compression failed")
+    }
+}
+
+func TestEOICode(t *testing.T) {
+    // The decoder stops at the EOI code and ignores what follows
+    encodedData, _, err := CompressWithOptions(strings.NewReader("Hello World!"), GIFOptions(8))
+    if err != nil {
+        t.Fatal(err)
+    }
+    withTrailingData := append(*encodedData, 0xff, 0xff, 0xff)
+    decodedData, err := UncompressWithOptions(bytes.NewReader(withTrailingData), GIFOptions(8))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(*decodedData) != "Hello World!" {
+        t.Errorf("Compression failed")
     }
 }
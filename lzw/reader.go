@@ -0,0 +1,174 @@
+package lzw
+
+import (
+    "bufio"
+    "errors"
+    "io"
+
+    "github.com/goossaert/compression/logging"
+)
+
+var ErrInvalidCode = errors.New("Invalid LZW code")
+
+
+// Reader uncompresses the data of an underlying reader. With an EOI code,
+// it stops right after it: if the underlying reader is an io.ByteReader, it
+// is read byte by byte, and no data past the end of the stream is consumed.
+type Reader struct {
+    opts Options
+    br *bitReader
+    numLiterals int
+    maxEntries int
+
+    // Each entry is its prefix entry followed by one byte. The literals have
+    // no prefix, their codes being their values.
+    prefix []uint16
+    suffix []byte
+    nextCode int
+    width uint
+    last int // previous code, -1 after a CLEAR code
+    scratch []byte // strings are decoded backwards at its end
+    variant *variantReader // LZMW and LZAP only
+
+    pending []byte // decoded bytes not returned yet
+    err error
+}
+
+func NewReader(reader io.Reader) *Reader {
+    lr, _ := NewReaderOptions(reader, DefaultOptions)
+    return lr
+}
+
+func NewReaderOptions(reader io.Reader, opts Options) (*Reader, error) {
+    if err := opts.validate(); err != nil {
+        return nil, err
+    }
+    lr := new(Reader)
+    lr.opts = opts
+    if byteReader, ok := reader.(io.ByteReader); ok {
+        lr.br = newBitReader(byteReader, opts.Order)
+    } else {
+        lr.br = newBitReader(bufio.NewReader(reader), opts.Order)
+    }
+    lr.numLiterals = 1 << uint(opts.litWidth())
+    lr.maxEntries = 1 << uint(opts.MaxBits)
+    lr.prefix = make([]uint16, lr.maxEntries)
+    lr.suffix = make([]byte, lr.maxEntries)
+    if opts.Growth == GrowthLZW {
+        lr.scratch = make([]byte, lr.maxEntries + 1)
+    } else {
+        lr.scratch = make([]byte, variantMaxLength)
+        lr.variant = newVariantReader(lr.maxEntries)
+    }
+    lr.resetDictionary()
+    logging.Trace.Printf("Uncompress()\n")
+    return lr, nil
+}
+
+func (lr *Reader) resetDictionary() {
+    lr.nextCode = lr.opts.firstCode()
+    lr.width = lr.opts.minWidth()
+    lr.last = -1
+}
+
+// expand writes the string of 'code' so that it ends right before 'end' in
+// the scratch buffer, and returns the index where it starts.
+func (lr *Reader) expand(code int, end int) int {
+    i := end
+    for code >= lr.numLiterals {
+        i -= 1
+        lr.scratch[i] = lr.suffix[code]
+        code = int(lr.prefix[code])
+    }
+    i -= 1
+    lr.scratch[i] = byte(code)
+    return i
+}
+
+func (lr *Reader) Read(p []byte) (int, error) {
+    n := 0
+    for n < len(p) {
+        if len(lr.pending) > 0 {
+            copied := copy(p[n:], lr.pending)
+            lr.pending = lr.pending[copied:]
+            n += copied
+            continue
+        }
+        if lr.err != nil {
+            break
+        }
+        lr.err = lr.decodeCode()
+    }
+    if n > 0 {
+        return n, nil
+    }
+    return 0, lr.err
+}
+
+// readError returns the error to give for a failed read of the compressed
+// data: with an EOI code, the data cannot end anywhere else than after it.
+func (lr *Reader) readError(err error) error {
+    if err == io.EOF && lr.opts.EOICode {
+        return io.ErrUnexpectedEOF
+    }
+    return err
+}
+
+// decodeCode decodes the next code into 'pending'.
+func (lr *Reader) decodeCode() error {
+    code, err := lr.br.ReadBits(lr.width)
+    if err != nil {
+        return lr.readError(err)
+    }
+
+    if lr.opts.hasClearCode() && code == lr.opts.clearCode() {
+        logging.Trace.Printf("CLEAR\n")
+        if lr.opts.AlignGroups {
+            if err := lr.br.SkipGroup(lr.width); err != nil {
+                return lr.readError(err)
+            }
+        }
+        lr.resetDictionary()
+        return nil
+    }
+    if lr.opts.EOICode && code == lr.opts.eoiCode() {
+        logging.Trace.Printf("EOI\n")
+        return io.EOF
+    }
+    if lr.variant != nil {
+        return lr.decodeVariant(code)
+    }
+
+    var current []byte
+    end := len(lr.scratch)
+    switch {
+    case code < lr.numLiterals || (code >= lr.opts.firstCode() && code < lr.nextCode):
+        current = lr.scratch[lr.expand(code, end):]
+    case code == lr.nextCode && lr.last >= 0 && lr.nextCode < lr.maxEntries:
+        // KwKwK: the entry the encoder has just added, the previous string
+        // followed by its own first byte
+        start := lr.expand(lr.last, end - 1)
+        lr.scratch[end - 1] = lr.scratch[start]
+        current = lr.scratch[start:]
+    default:
+        return ErrInvalidCode
+    }
+    if lr.last >= 0 && lr.nextCode < lr.maxEntries {
+        lr.prefix[lr.nextCode] = uint16(lr.last)
+        lr.suffix[lr.nextCode] = current[0]
+        lr.nextCode += 1
+    }
+    // Mirrors the encoder, which has already added the entry 'nextCode'
+    if lr.opts.widens(lr.nextCode, lr.width) {
+        if lr.opts.AlignGroups {
+            if err := lr.br.SkipGroup(lr.width); err != nil {
+                lr.pending = current
+                return lr.readError(err)
+            }
+        }
+        lr.width += 1
+    }
+    lr.last = code
+    lr.pending = current
+    return nil
+}
@@ -0,0 +1,156 @@
+package lzw
+
+import (
+    "bytes"
+    "io"
+    "io/ioutil"
+    "math/rand"
+    "testing"
+    "testing/iotest"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+    originalData := generateText(300000, 10)
+
+    var buf bytes.Buffer
+    lw := NewWriter(&buf)
+    // Writes in small, uneven chunks
+    for i := 0; i < len(originalData); i += 777 {
+        end := i + 777
+        if end > len(originalData) {
+            end = len(originalData)
+        }
+        if _, err := lw.Write(originalData[i:end]); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := lw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := lw.Write([]byte("a")); err != ErrWriterClosed {
+        t.Errorf("Expected ErrWriterClosed, found %v", err)
+    }
+
+    readers := []io.Reader {
+        bytes.NewReader(buf.Bytes()),
+        iotest.OneByteReader(bytes.NewReader(buf.Bytes())),
+        iotest.HalfReader(bytes.NewReader(buf.Bytes())),
+    }
+    for _, r := range readers {
+        decodedData, err := ioutil.ReadAll(iotest.OneByteReader(NewReader(r)))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if bytes.Equal(originalData, decodedData) == false {
+            t.Errorf("Compression failed")
+        }
+    }
+}
+
+func TestStreamSelfTerminating(t *testing.T) {
+    var buf bytes.Buffer
+    lw := NewWriter(&buf)
+    lw.Write([]byte("first stream, first stream"))
+    lw.Close()
+    lw = NewWriter(&buf)
+    lw.Write([]byte("second stream"))
+    lw.Close()
+
+    // Two streams back to back, read without any length
+    r := bytes.NewReader(buf.Bytes())
+    for _, expected := range []string{"first stream, first stream", "second stream"} {
+        decodedData, err := ioutil.ReadAll(NewReader(r))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if string(decodedData) != expected {
+            t.Errorf("Expected %q, found %q", expected, decodedData)
+        }
+    }
+    if r.Len() != 0 {
+        t.Errorf("%d bytes left after the second stream", r.Len())
+    }
+}
+
+func TestStreamTruncated(t *testing.T) {
+    var buf bytes.Buffer
+    lw := NewWriter(&buf)
+    lw.Write(generateText(10000, 11))
+    lw.Close()
+
+    truncated := buf.Bytes()[:buf.Len()-4]
+    if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(truncated))); err != io.ErrUnexpectedEOF {
+        t.Errorf("Expected io.ErrUnexpectedEOF, found %v", err)
+    }
+}
+
+// packCodes packs 9-bit codes as the encoder would
+func packCodes(codes ...int) []byte {
+    var buf bytes.Buffer
+    bw := newBitWriter(&buf, LSB)
+    for _, code := range codes {
+        bw.WriteBits(code, 9)
+    }
+    bw.Flush()
+    return buf.Bytes()
+}
+
+func TestInvalidCodes(t *testing.T) {
+    tests := []struct {
+        opts Options
+        codes []int
+        expected string
+        err error
+    } {
+        {DefaultOptions, []int{256, 'A', 258, 257}, "AAA", nil},
+        {Options{MaxBits: 12}, []int{'A', 256}, "AAA", nil},
+        // Code above the next entry
+        {DefaultOptions, []int{256, 300, 257}, "", ErrInvalidCode},
+        {DefaultOptions, []int{256, 'A', 259, 257}, "A", ErrInvalidCode},
+        // Next entry without a previous code to build it from
+        {DefaultOptions, []int{256, 258, 257}, "", ErrInvalidCode},
+        {DefaultOptions, []int{256, 'A', 256, 258, 257}, "A", ErrInvalidCode},
+        {Options{MaxBits: 12}, []int{256}, "", ErrInvalidCode},
+    }
+    for _, test := range tests {
+        lr, err := NewReaderOptions(bytes.NewReader(packCodes(test.codes...)), test.opts)
+        if err != nil {
+            t.Fatal(err)
+        }
+        decodedData, err := ioutil.ReadAll(lr)
+        if string(decodedData) != test.expected || err != test.err {
+            t.Errorf("Codes %v: expected %q, %v, found %q, %v", test.codes, test.expected, test.err, decodedData, err)
+        }
+        // The error sticks
+        if n, err2 := lr.Read(make([]byte, 10)); n != 0 || err2 != err && !(err == nil && err2 == io.EOF) {
+            t.Errorf("Codes %v: read %d bytes and %v after %v", test.codes, n, err2, err)
+        }
+    }
+}
+
+func TestReadError(t *testing.T) {
+    var buf bytes.Buffer
+    lw := NewWriter(&buf)
+    lw.Write(generateText(10000, 13))
+    lw.Close()
+
+    // Errors of the underlying reader are returned as they are
+    r := iotest.TimeoutReader(iotest.HalfReader(bytes.NewReader(buf.Bytes())))
+    if _, err := ioutil.ReadAll(NewReader(r)); err != iotest.ErrTimeout {
+        t.Errorf("Expected iotest.ErrTimeout, found %v", err)
+    }
+}
+
+func TestMalformedInput(t *testing.T) {
+    // Random data must give errors, never panics
+    optsList := []Options{DefaultOptions, GIFOptions(2), TIFFOptions(), ZOptions(9, true), {MaxBits: 12}}
+    r := rand.New(rand.NewSource(14))
+    for i := 0 ; i < 2000 ; i++ {
+        data := make([]byte, r.Intn(200))
+        r.Read(data)
+        for _, opts := range optsList {
+            lr, _ := NewReaderOptions(bytes.NewReader(data), opts)
+            ioutil.ReadAll(lr)
+        }
+    }
+}
@@ -0,0 +1,303 @@
+package lzw
+
+import (
+    "github.com/goossaert/compression/logging"
+)
+
+// LZMW (Miller and Wegman) and LZAP (Storer) grow the dictionary from the
+// previous match and the whole current one, once the current code has been
+// written. The decoder then knows both matches in full when it adds the same
+// entries, and a code never refers to the entry being built.
+//
+// With LZMW, the prefixes of an entry are not necessarily in the dictionary,
+// so the encoder walks a trie whose nodes are not all codes, and falls back
+// to the longest match that is one. Entries longer than variantMaxLength are
+// not added, which bounds the memory of the decoder.
+const variantMaxLength = 1 << 16
+
+type variantWriter struct {
+    trie *dictionary // (node, byte) => node
+    nodeCodes []int32 // code of each node, -1 if it is not an entry
+    numNodes int
+
+    lookahead []byte // bytes of the current match, and past it
+    walked int // number of bytes of the lookahead walked in the trie
+    node int
+
+    matchCode int
+    matchNode int
+    matchLen int
+
+    prevNode int
+    prevLen int // 0 if there is no previous match
+}
+
+func newVariantWriter(opts Options, numLiterals int) *variantWriter {
+    v := new(variantWriter)
+    // Twice as many nodes as entries, in a table kept half full
+    v.trie = newDictionary(opts.MaxBits + 2)
+    v.nodeCodes = make([]int32, 1 << uint(opts.MaxBits + 1))
+    for i := 0 ; i < numLiterals ; i++ {
+        v.nodeCodes[i] = int32(i)
+    }
+    v.reset(numLiterals)
+    return v
+}
+
+func (v *variantWriter) reset(numLiterals int) {
+    v.trie.reset()
+    v.numNodes = numLiterals
+    v.prevLen = 0
+}
+
+// child returns the node extending 'node' with 'b', creating it if needed.
+// It returns -1 once the trie is full: the entries are then still numbered,
+// but the encoder cannot find them.
+func (v *variantWriter) child(node int, b byte) int {
+    if node < 0 {
+        return -1
+    }
+    if next, ok := v.trie.get(node, b); ok {
+        return next
+    }
+    if v.numNodes == len(v.nodeCodes) {
+        return -1
+    }
+    next := v.numNodes
+    v.numNodes += 1
+    v.trie.put(node, b, next)
+    v.nodeCodes[next] = -1
+    return next
+}
+
+func (v *variantWriter) setCode(node int, code int) {
+    // A string already in the dictionary keeps its first code
+    if node >= 0 && v.nodeCodes[node] < 0 {
+        v.nodeCodes[node] = int32(code)
+    }
+}
+
+
+func (lw *Writer) writeVariant(p []byte) (int, error) {
+    for i := 0 ; i < len(p) ; i++ {
+        if int(p[i]) >= lw.numLiterals {
+            lw.err = ErrInvalidLiteral
+            return i, lw.err
+        }
+        lw.numBytesRead += 1
+        lw.variant.lookahead = append(lw.variant.lookahead, p[i])
+        if lw.err = lw.matchVariant(false); lw.err != nil {
+            return i, lw.err
+        }
+    }
+    return len(p), nil
+}
+
+// matchVariant walks the trie along the lookahead, and writes the longest
+// match every time the walk cannot go further. Unless 'final' is set, it
+// stops when it runs out of lookahead, as more data could extend the match.
+func (lw *Writer) matchVariant(final bool) error {
+    v := lw.variant
+    for {
+        for v.walked < len(v.lookahead) {
+            b := v.lookahead[v.walked]
+            next := int(b)
+            if v.walked > 0 {
+                var ok bool
+                if next, ok = v.trie.get(v.node, b); !ok {
+                    break
+                }
+            }
+            v.node = next
+            v.walked += 1
+            if code := v.nodeCodes[next]; code >= 0 {
+                v.matchCode, v.matchNode, v.matchLen = int(code), next, v.walked
+            }
+        }
+        if len(v.lookahead) == 0 || (v.walked == len(v.lookahead) && !final) {
+            return nil
+        }
+        if err := lw.emitVariant(); err != nil {
+            return err
+        }
+    }
+}
+
+// emitVariant writes the current match, grows the dictionary, and restarts
+// the walk right after the match.
+func (lw *Writer) emitVariant() error {
+    v := lw.variant
+    if err := lw.bw.WriteBits(v.matchCode, lw.width); err != nil {
+        return err
+    }
+    current := v.lookahead[:v.matchLen]
+
+    // Long LZMW entries can fill the trie well before the dictionary, and
+    // the encoder then resets as if the dictionary were full. The decoder
+    // adds an entry for every code until 'nextCode' reaches maxEntries, so
+    // the encoder adds it too, and widens the codes, before the CLEAR code.
+    full := lw.nextCode >= lw.maxEntries
+    if v.prevLen > 0 && !full {
+        lw.growVariant(current)
+        full = v.numNodes == len(v.nodeCodes)
+    }
+    for lw.opts.variantWidens(lw.nextCode, lw.width) {
+        if lw.opts.AlignGroups {
+            if err := lw.bw.PadGroup(lw.width); err != nil {
+                return err
+            }
+        }
+        lw.width += 1
+    }
+    cleared := false
+    if v.prevLen > 0 && full && (lw.opts.Full == FullReset || (lw.opts.Full == FullAdaptiveReset && lw.ratioDeclined())) {
+        logging.Trace.Printf("CLEAR\n")
+        if err := lw.bw.WriteBits(lw.opts.clearCode(), lw.width); err != nil {
+            return err
+        }
+        if lw.opts.AlignGroups {
+            if err := lw.bw.PadGroup(lw.width); err != nil {
+                return err
+            }
+        }
+        lw.resetDictionary()
+        cleared = true
+    }
+
+    if !cleared {
+        v.prevNode, v.prevLen = v.matchNode, v.matchLen
+    }
+    n := copy(v.lookahead, v.lookahead[v.matchLen:])
+    v.lookahead = v.lookahead[:n]
+    v.walked = 0
+    return nil
+}
+
+// growVariant adds the entries made of the previous match and 'current'.
+// Reader.growVariant must add exactly the same ones.
+func (lw *Writer) growVariant(current []byte) {
+    v := lw.variant
+    node := v.prevNode
+    switch lw.opts.Growth {
+    case GrowthLZMW:
+        if v.prevLen + len(current) > variantMaxLength {
+            return
+        }
+        for _, b := range current {
+            node = v.child(node, b)
+        }
+        v.setCode(node, lw.nextCode)
+        lw.nextCode += 1
+    case GrowthLZAP:
+        for k, b := range current {
+            if lw.nextCode >= lw.maxEntries || v.prevLen + k + 1 > variantMaxLength {
+                return
+            }
+            node = v.child(node, b)
+            v.setCode(node, lw.nextCode)
+            lw.nextCode += 1
+        }
+    }
+}
+
+
+// variantReader holds what the decoder needs on top of the prefix and
+// suffix tables. An LZAP entry is an entry followed by a byte, as with LZW,
+// but an LZMW entry is an entry followed by another, kept in 'tail'.
+type variantReader struct {
+    tail []uint16
+    lengths []uint32
+    stack []uint16
+}
+
+func newVariantReader(maxEntries int) *variantReader {
+    v := new(variantReader)
+    v.tail = make([]uint16, maxEntries)
+    v.lengths = make([]uint32, maxEntries)
+    return v
+}
+
+func (lr *Reader) codeLength(code int) int {
+    if code < lr.numLiterals {
+        return 1
+    }
+    return int(lr.variant.lengths[code])
+}
+
+// expandPairs writes the string of the LZMW entry 'code' so that it ends
+// right before 'end' in the scratch buffer, and returns where it starts.
+func (lr *Reader) expandPairs(code int, end int) int {
+    v := lr.variant
+    i := end
+    v.stack = append(v.stack[:0], uint16(code))
+    for len(v.stack) > 0 {
+        code := int(v.stack[len(v.stack) - 1])
+        v.stack = v.stack[:len(v.stack) - 1]
+        // Backwards, so the tail comes before the prefix
+        for code >= lr.numLiterals {
+            v.stack = append(v.stack, lr.prefix[code])
+            code = int(v.tail[code])
+        }
+        i -= 1
+        lr.scratch[i] = byte(code)
+    }
+    return i
+}
+
+func (lr *Reader) decodeVariant(code int) error {
+    if code >= lr.numLiterals && (code < lr.opts.firstCode() || code >= lr.nextCode) {
+        return ErrInvalidCode
+    }
+    var start int
+    if lr.opts.Growth == GrowthLZMW {
+        start = lr.expandPairs(code, len(lr.scratch))
+    } else {
+        start = lr.expand(code, len(lr.scratch))
+    }
+    current := lr.scratch[start:]
+
+    if lr.last >= 0 && lr.nextCode < lr.maxEntries {
+        lr.growVariant(code, current)
+    }
+    for lr.opts.variantWidens(lr.nextCode, lr.width) {
+        if lr.opts.AlignGroups {
+            if err := lr.br.SkipGroup(lr.width); err != nil {
+                lr.pending = current
+                return lr.readError(err)
+            }
+        }
+        lr.width += 1
+    }
+    lr.last = code
+    lr.pending = current
+    return nil
+}
+
+// growVariant adds the entries made of the previous code and the current
+// one, which decodes to 'current'.
+func (lr *Reader) growVariant(code int, current []byte) {
+    v := lr.variant
+    lastLength := lr.codeLength(lr.last)
+    switch lr.opts.Growth {
+    case GrowthLZMW:
+        if lastLength + len(current) > variantMaxLength {
+            return
+        }
+        lr.prefix[lr.nextCode] = uint16(lr.last)
+        v.tail[lr.nextCode] = uint16(code)
+        v.lengths[lr.nextCode] = uint32(lastLength + len(current))
+        lr.nextCode += 1
+    case GrowthLZAP:
+        prefix := lr.last
+        for k := 1 ; k <= len(current) ; k++ {
+            if lr.nextCode >= lr.maxEntries || lastLength + k > variantMaxLength {
+                return
+            }
+            lr.prefix[lr.nextCode] = uint16(prefix)
+            lr.suffix[lr.nextCode] = current[k - 1]
+            v.lengths[lr.nextCode] = uint32(lastLength + k)
+            prefix = lr.nextCode
+            lr.nextCode += 1
+        }
+    }
+}
@@ -0,0 +1,188 @@
+package lzw
+
+import (
+    "bytes"
+    "fmt"
+    "io/ioutil"
+    "math/rand"
+    "strings"
+    "testing"
+    "testing/iotest"
+)
+
+// configSnapshots returns successive dumps of the same configuration, with
+// a few values changing from one to the next.
+func configSnapshots(numSnapshots int, seed int64) []byte {
+    r := rand.New(rand.NewSource(seed))
+    values := make([]int, 40)
+    var buf bytes.Buffer
+    for i := 0 ; i < numSnapshots ; i++ {
+        values[r.Intn(len(values))] = r.Intn(100000)
+        fmt.Fprintf(&buf, "# snapshot %d\n[server]\n", i)
+        for j, value := range values {
+            fmt.Fprintf(&buf, "option_%02d = %d\n", j, value)
+        }
+    }
+    return buf.Bytes()
+}
+
+func TestGrowthRoundTrip(t *testing.T) {
+    inputs := [][]byte {
+        []byte("ABABABABABABABABAAAAAAAAAAAAAA"),
+        generateText(200000, 15),
+        configSnapshots(300, 16),
+        // Entries reach the maximum length
+        bytes.Repeat([]byte{'a'}, 300000),
+    }
+    optsList := []Options {
+        DefaultOptions,
+        {MaxBits: 10},
+        {MaxBits: 9, Full: FullReset},
+        {Order: MSB, MaxBits: 12, Full: FullReset, EOICode: true},
+        ZOptions(9, true),
+        ZOptions(12, true),
+    }
+    for _, growth := range []Growth{GrowthLZMW, GrowthLZAP} {
+        for _, opts := range optsList {
+            opts.Growth = growth
+            for _, originalData := range inputs {
+                encodedData, _, err := CompressWithOptions(bytes.NewReader(originalData), opts)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                decodedData, err := UncompressWithOptions(bytes.NewReader(*encodedData), opts)
+                if err != nil {
+                    t.Fatalf("%+v: %v", opts, err)
+                }
+                if bytes.Equal(originalData, *decodedData) == false {
+                    t.Errorf("Compression failed with %+v", opts)
+                }
+            }
+        }
+    }
+}
+
+// repeatedBlocks returns a few random blocks repeated in a random order, so
+// that the LZMW entries grow long and fill the trie well before the
+// dictionary.
+func repeatedBlocks(size int, blockSize int, numBlocks int, seed int64) []byte {
+    r := rand.New(rand.NewSource(seed))
+    blocks := make([][]byte, numBlocks)
+    for i := range blocks {
+        blocks[i] = make([]byte, blockSize)
+        r.Read(blocks[i])
+    }
+    var data []byte
+    for len(data) < size {
+        data = append(data, blocks[r.Intn(numBlocks)]...)
+    }
+    return data
+}
+
+func TestGrowthTrieFull(t *testing.T) {
+    opts := Options{MaxBits: 11, Full: FullReset, Growth: GrowthLZMW}
+    shapes := [][2]int{{12, 4}, {16, 4}, {20, 3}, {32, 3}}
+    for _, seed := range []int64{10, 17, 78} {
+        for _, shape := range shapes {
+            originalData := repeatedBlocks(100000, shape[0], shape[1], seed)
+            encodedData, _, err := CompressWithOptions(bytes.NewReader(originalData), opts)
+            if err != nil {
+                t.Fatal(err)
+            }
+            decodedData, err := UncompressWithOptions(bytes.NewReader(*encodedData), opts)
+            if err != nil {
+                t.Fatalf("Seed %d, %d blocks of %d bytes: %v", seed, shape[1], shape[0], err)
+            }
+            if bytes.Equal(originalData, *decodedData) == false {
+                t.Errorf("Seed %d, %d blocks of %d bytes: compression failed", seed, shape[1], shape[0])
+            }
+        }
+    }
+}
+
+func TestGrowthStream(t *testing.T) {
+    originalData := configSnapshots(100, 17)
+    opts := DefaultOptions
+    opts.Growth = GrowthLZMW
+
+    // One byte at a time, so that matches span many writes
+    var buf bytes.Buffer
+    lw, err := NewWriterOptions(&buf, opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for i := range originalData {
+        lw.Write(originalData[i:i+1])
+    }
+    if err := lw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    lr, err := NewReaderOptions(iotest.HalfReader(bytes.NewReader(buf.Bytes())), opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    decodedData, err := ioutil.ReadAll(iotest.OneByteReader(lr))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if bytes.Equal(originalData, decodedData) == false {
+        t.Errorf("Compression failed")
+    }
+}
+
+func TestGrowthInvalid(t *testing.T) {
+    // Without KwKwK, the next entry is never a valid code
+    opts := DefaultOptions
+    opts.Growth = GrowthLZAP
+    _, err := UncompressWithOptions(bytes.NewReader(packCodes(256, 'A', 258, 257)), opts)
+    if err != ErrInvalidCode {
+        t.Errorf("Expected ErrInvalidCode, found %v", err)
+    }
+
+    opts.EarlyChange = true
+    if _, _, err := CompressWithOptions(strings.NewReader("abc"), opts); err != ErrInvalidOptions {
+        t.Errorf("Expected ErrInvalidOptions, found %v", err)
+    }
+    if _, _, err := CompressWithOptions(strings.NewReader("abc"), Options{MaxBits: 12, Growth: 3}); err != ErrInvalidOptions {
+        t.Errorf("Expected ErrInvalidOptions, found %v", err)
+    }
+
+    r := rand.New(rand.NewSource(18))
+    for i := 0 ; i < 1000 ; i++ {
+        data := make([]byte, r.Intn(200))
+        r.Read(data)
+        for _, growth := range []Growth{GrowthLZMW, GrowthLZAP} {
+            lr, _ := NewReaderOptions(bytes.NewReader(data), Options{MaxBits: 10, Growth: growth})
+            ioutil.ReadAll(lr)
+        }
+    }
+}
+
+func TestGrowthConfigSnapshots(t *testing.T) {
+    originalData := configSnapshots(2000, 19)
+    sizes := make(map[Growth]int)
+    for _, growth := range []Growth{GrowthLZW, GrowthLZMW, GrowthLZAP} {
+        opts := DefaultOptions
+        opts.Growth = growth
+        encodedData, _, err := CompressWithOptions(bytes.NewReader(originalData), opts)
+        if err != nil {
+            t.Fatal(err)
+        }
+        sizes[growth] = len(*encodedData)
+    }
+    t.Logf("%d bytes: LZW %d, LZMW %d, LZAP %d", len(originalData), sizes[GrowthLZW], sizes[GrowthLZMW], sizes[GrowthLZAP])
+    if sizes[GrowthLZMW] >= sizes[GrowthLZW] || sizes[GrowthLZAP] >= sizes[GrowthLZW] {
+        t.Errorf("Expected LZMW and LZAP to compress the snapshots better than LZW")
+    }
+}
+
+func BenchmarkCompressLZMW(b *testing.B) {
+    originalData := configSnapshots(2000, 19)
+    opts := DefaultOptions
+    opts.Growth = GrowthLZMW
+    b.SetBytes(int64(len(originalData)))
+    b.ResetTimer()
+    for i := 0 ; i < b.N ; i++ {
+        CompressWithOptions(bytes.NewReader(originalData), opts)
+    }
+}
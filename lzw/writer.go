@@ -0,0 +1,247 @@
+package lzw
+
+import (
+    "errors"
+    "io"
+
+    "github.com/goossaert/compression/logging"
+)
+
+var (
+    ErrInvalidLiteral = errors.New("Input byte does not fit in the literal width")
+    ErrWriterClosed = errors.New("LZW writer is closed")
+)
+
+
+// The dictionary of the encoder maps a (prefix code, byte) pair to the code
+// of the entry extending the prefix with the byte. It is an open-addressing
+// hash table with linear probing, of 2^tableBits slots, which the callers
+// keep at most half full. An empty slot holds 0, and a used one holds key+1.
+type dictionary struct {
+    keys []uint32
+    codes []uint32
+    shift uint
+    mask uint32
+}
+
+func newDictionary(tableBits int) *dictionary {
+    d := new(dictionary)
+    d.keys = make([]uint32, 1 << uint(tableBits))
+    d.codes = make([]uint32, 1 << uint(tableBits))
+    d.shift = uint(32 - tableBits)
+    d.mask = uint32(len(d.keys) - 1)
+    return d
+}
+
+func (d *dictionary) reset() {
+    for i := range d.keys {
+        d.keys[i] = 0
+    }
+}
+
+func (d *dictionary) slot(key uint32) uint32 {
+    return ((key >> 12) ^ key) * 0x9e3779b1 >> d.shift
+}
+
+func (d *dictionary) get(prefix int, b byte) (int, bool) {
+    key := uint32(prefix) << 8 | uint32(b)
+    for slot := d.slot(key); ; slot = (slot + 1) & d.mask {
+        if d.keys[slot] == 0 {
+            return 0, false
+        }
+        if d.keys[slot] == key + 1 {
+            return int(d.codes[slot]), true
+        }
+    }
+}
+
+func (d *dictionary) put(prefix int, b byte, code int) {
+    key := uint32(prefix) << 8 | uint32(b)
+    slot := d.slot(key)
+    for d.keys[slot] != 0 {
+        slot = (slot + 1) & d.mask
+    }
+    d.keys[slot] = key + 1
+    d.codes[slot] = uint32(code)
+}
+
+
+// Writer compresses the data written to it into an underlying writer. It
+// only keeps the dictionary, the code of the current match and a small
+// output buffer.
+type Writer struct {
+    opts Options
+    bw *bitWriter
+    numLiterals int
+    maxEntries int
+
+    dict *dictionary
+    nextCode int
+    width uint
+    current int // code of the current match, -1 if there is none
+    variant *variantWriter // LZMW and LZAP only
+
+    // Compression ratio tracking for FullAdaptiveReset
+    numBytesRead int
+    checkpoint int
+    ratio int
+
+    err error
+}
+
+func NewWriter(writer io.Writer) *Writer {
+    lw, _ := NewWriterOptions(writer, DefaultOptions)
+    return lw
+}
+
+func NewWriterOptions(writer io.Writer, opts Options) (*Writer, error) {
+    if err := opts.validate(); err != nil {
+        return nil, err
+    }
+    lw := new(Writer)
+    lw.opts = opts
+    lw.bw = newBitWriter(writer, opts.Order)
+    lw.numLiterals = 1 << uint(opts.litWidth())
+    lw.maxEntries = 1 << uint(opts.MaxBits)
+    lw.checkpoint = adaptiveResetCheckGap
+    lw.current = -1
+    if opts.Growth == GrowthLZW {
+        lw.dict = newDictionary(opts.MaxBits + 1)
+    } else {
+        lw.variant = newVariantWriter(opts, lw.numLiterals)
+    }
+    lw.resetDictionary()
+    logging.Trace.Printf("Compress()\n")
+
+    if opts.EOICode {
+        lw.err = lw.bw.WriteBits(opts.clearCode(), lw.width)
+    }
+    return lw, nil
+}
+
+// resetDictionary empties the dictionary. The literals are not stored, as
+// their codes are their values.
+func (lw *Writer) resetDictionary() {
+    if lw.variant != nil {
+        lw.variant.reset(lw.numLiterals)
+    } else {
+        lw.dict.reset()
+    }
+    lw.nextCode = lw.opts.firstCode()
+    lw.width = lw.opts.minWidth()
+}
+
+func (lw *Writer) ratioDeclined() bool {
+    if lw.numBytesRead < lw.checkpoint {
+        return false
+    }
+    lw.checkpoint = lw.numBytesRead + adaptiveResetCheckGap
+    numBytesWritten := lw.bw.numBitsWritten / 8
+    if numBytesWritten == 0 {
+        return false
+    }
+    currentRatio := lw.numBytesRead * 256 / numBytesWritten
+    if currentRatio > lw.ratio {
+        lw.ratio = currentRatio
+        return false
+    }
+    lw.ratio = 0
+    return true
+}
+
+// writeCode writes 'code', then widens the codes if the entry 'nextCode',
+// about to be added, needs it. The decoder adds that entry only after reading
+// the next code, but knows it exists, so both sides widen at the same point.
+func (lw *Writer) writeCode(code int) error {
+    if err := lw.bw.WriteBits(code, lw.width); err != nil {
+        return err
+    }
+    if lw.opts.widens(lw.nextCode, lw.width) {
+        if lw.opts.AlignGroups {
+            if err := lw.bw.PadGroup(lw.width); err != nil {
+                return err
+            }
+        }
+        lw.width += 1
+    }
+    return nil
+}
+
+func (lw *Writer) Write(p []byte) (int, error) {
+    if lw.err != nil {
+        return 0, lw.err
+    }
+    if lw.variant != nil {
+        return lw.writeVariant(p)
+    }
+    for i := 0 ; i < len(p) ; i++ {
+        if int(p[i]) >= lw.numLiterals {
+            lw.err = ErrInvalidLiteral
+            return i, lw.err
+        }
+        lw.numBytesRead += 1
+        if lw.current < 0 {
+            lw.current = int(p[i])
+            continue
+        }
+        if code, ok := lw.dict.get(lw.current, p[i]); ok {
+            lw.current = code
+            continue
+        }
+
+        if lw.err = lw.writeCode(lw.current); lw.err != nil {
+            return i, lw.err
+        }
+
+        if lw.nextCode < lw.maxEntries {
+            lw.dict.put(lw.current, p[i], lw.nextCode)
+            lw.nextCode += 1
+        } else if lw.opts.Full == FullReset || (lw.opts.Full == FullAdaptiveReset && lw.ratioDeclined()) {
+            logging.Trace.Printf("CLEAR\n")
+            if lw.err = lw.bw.WriteBits(lw.opts.clearCode(), lw.width); lw.err != nil {
+                return i, lw.err
+            }
+            if lw.opts.AlignGroups {
+                if lw.err = lw.bw.PadGroup(lw.width); lw.err != nil {
+                    return i, lw.err
+                }
+            }
+            lw.resetDictionary()
+        }
+
+        lw.current = int(p[i])
+    }
+    return len(p), nil
+}
+
+// Close writes the last code, the EOI code if there is one, and flushes the
+// output. It does not close the underlying writer.
+func (lw *Writer) Close() error {
+    if lw.err == ErrWriterClosed {
+        return nil
+    }
+    if lw.err != nil {
+        return lw.err
+    }
+
+    // Flush out the last match
+    if lw.variant != nil {
+        if lw.err = lw.matchVariant(true); lw.err != nil {
+            return lw.err
+        }
+    } else if lw.current >= 0 {
+        if lw.err = lw.writeCode(lw.current); lw.err != nil {
+            return lw.err
+        }
+    }
+    if lw.opts.EOICode {
+        if lw.err = lw.bw.WriteBits(lw.opts.eoiCode(), lw.width); lw.err != nil {
+            return lw.err
+        }
+    }
+    if lw.err = lw.bw.Flush(); lw.err != nil {
+        return lw.err
+    }
+    lw.err = ErrWriterClosed
+    return nil
+}